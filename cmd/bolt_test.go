@@ -1,17 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"fmt"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	c "github.com/fnando/bolt/common"
+	"github.com/fnando/bolt/internal/reporters"
 	"github.com/stretchr/testify/require"
 )
 
@@ -47,6 +53,10 @@ func normalizeElapsedText(input string) string {
 }
 
 func run(args []string, env []string) (execResult, error) {
+	return runWithInput(args, env, "")
+}
+
+func runWithInput(args []string, env []string, input string) (execResult, error) {
 	args = append([]string{"run", "./cmd/bolt.go"}, args...)
 	stdout := bytes.NewBufferString("")
 	stderr := bytes.NewBufferString("")
@@ -56,6 +66,7 @@ func run(args []string, env []string) (execResult, error) {
 	cmd.Stdout = stdout
 	cmd.Env = append(os.Environ(), env...)
 	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
 	err := cmd.Start()
 
 	if err != nil {
@@ -91,6 +102,54 @@ func run(args []string, env []string) (execResult, error) {
 	return result, err
 }
 
+// runIn builds bolt and runs it from the given directory, for cases that
+// need a project other than bolt itself.
+func runIn(t *testing.T, dir string, args []string) execResult {
+	stdout := bytes.NewBufferString("")
+	cmd := exec.Command(build(t), args...)
+	cmd.Dir = dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stdout
+	err := cmd.Run()
+	result := execResult{stdout: stdout.String()}
+
+	if exiterr, ok := err.(*exec.ExitError); ok {
+		result.exitcode = exiterr.ExitCode()
+	} else {
+		require.NoError(t, err)
+	}
+
+	return result
+}
+
+// tempHome sets HOME to a temporary directory, so the last run and timings
+// bolt saves to ~/.bolt/cache don't leak between tests.
+func tempHome(t *testing.T) string {
+	// Go caches are kept, as they're relative to HOME by default.
+	out, err := exec.Command("go", "env", "GOCACHE", "GOMODCACHE").Output()
+	require.NoError(t, err)
+	caches := strings.Fields(string(out))
+	t.Setenv("GOCACHE", caches[0])
+	t.Setenv("GOMODCACHE", caches[1])
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	return home
+}
+
+func build(t *testing.T) string {
+	bin := path.Join(t.TempDir(), "bolt")
+	out, err := exec.Command("go", "build", "-o", bin, "./cmd/bolt.go").CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	return bin
+}
+
+func write(t *testing.T, path string, contents string) {
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+}
+
 func TestMain(m *testing.M) {
 	c.Clock.Now = time.Now
 	exitcode := m.Run()
@@ -154,115 +213,1205 @@ func TestRunCommand(t *testing.T) {
 		require.Equal(t, 0, result.exitcode)
 	})
 
-	t.Run("CustomSymbols", func(t *testing.T) {
+	t.Run("SubtestsReplayFile", func(t *testing.T) {
 		result, err := run(
-			[]string{"run", "--no-color", "--replay", "test/replays/run-mixed.txt"},
-			[]string{"BOLT_FAIL_SYMBOL=❌", "BOLT_PASS_SYMBOL=⚡️", "BOLT_SKIP_SYMBOL=😴"},
+			[]string{"run", "--no-color", "--replay", "test/replays/run-subtests.txt"},
+			[]string{},
 		)
 
 		require.NoError(t, err)
-		require.Contains(t, result.stdout, "⚡️⚡️❌❌❌⚡️⚡️⚡️😴😴")
+		require.Equal(t, read("test/expected/run-subtests.txt"), normalizeElapsedText(result.stdout))
+		require.Contains(t, result.stderr, "exit status 2")
+		require.Equal(t, 1, result.exitcode)
 	})
 
-	t.Run("ColorOutput", func(t *testing.T) {
+	t.Run("ExamplesReplayFile", func(t *testing.T) {
 		result, err := run(
-			[]string{"run", "--replay", "test/replays/run-mixed.txt"},
+			[]string{"run", "--no-color", "--replay", "test/replays/run-examples.txt"},
 			[]string{},
 		)
 
 		require.NoError(t, err)
-		require.Equal(
-			t,
-			read("test/expected/run-mixed-color.txt"),
-			normalizeElapsedText(result.stdout),
+		require.Equal(t, read("test/expected/run-examples.txt"), normalizeElapsedText(result.stdout))
+		require.Contains(t, result.stderr, "exit status 1")
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("FuzzReplayFile", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-fuzz.txt"},
+			[]string{},
 		)
-		require.Contains(t, result.stderr, "exit status 3")
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-fuzz.txt"), normalizeElapsedText(result.stdout))
+		require.Contains(t, result.stderr, "exit status 1")
 		require.Equal(t, 1, result.exitcode)
 	})
 
-	t.Run("CustomColorOutput", func(t *testing.T) {
+	t.Run("BenchmarkMetricsReplayFile", func(t *testing.T) {
 		result, err := run(
-			[]string{"run", "--replay", "test/replays/run-mixed.txt"},
-			[]string{
-				"BOLT_TEXT_COLOR=31",
-				"BOLT_FAIL_COLOR=32",
-				"BOLT_PASS_COLOR=33",
-				"BOLT_SKIP_COLOR=34",
-				"BOLT_DETAIL_COLOR=35",
-			},
+			[]string{"run", "--no-color", "--replay", "test/replays/run-benchmem.txt"},
+			[]string{},
 		)
 
 		require.NoError(t, err)
-		require.Equal(
-			t,
-			read("test/expected/run-mixed-custom-color.txt"),
-			normalizeElapsedText(result.stdout),
+		require.Equal(t, read("test/expected/run-benchmem.txt"), normalizeElapsedText(result.stdout))
+		require.Equal(t, 0, result.exitcode)
+	})
+
+	t.Run("PanicReplayFile", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-panic.txt"},
+			[]string{},
 		)
-		require.Contains(t, result.stderr, "exit status 3")
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-panic.txt"), normalizeElapsedText(result.stdout))
 		require.Equal(t, 1, result.exitcode)
 	})
 
-	t.Run("ReplayError", func(t *testing.T) {
+	t.Run("PanicModuleWithoutDot", func(t *testing.T) {
 		result, err := run(
-			[]string{"run", "--replay", "test/replays/run-error.txt"},
+			[]string{"run", "--no-color", "--replay", "test/replays/run-panic-module.txt"},
 			[]string{},
 		)
 
 		require.NoError(t, err)
-		require.Equal(t, read("test/expected/run-error.txt"), result.stdout)
+		require.Contains(t, result.stdout, "   myapp.greet\n       /home/test/bolt/panic/main_test.go:13\n")
+		require.Contains(t, result.stdout, "   myapp.TestNilUser\n       /home/test/bolt/panic/main_test.go:20\n")
+		require.NotContains(t, result.stdout, "testing.tRunner")
 		require.Equal(t, 1, result.exitcode)
 	})
 
-	t.Run("ReplayNoTests", func(t *testing.T) {
+	t.Run("PanicSubtest", func(t *testing.T) {
 		result, err := run(
-			[]string{"run", "--no-color", "--replay", "test/replays/run-no-tests.txt"},
+			[]string{"run", "--no-color", "--replay", "test/replays/run-panic-subtest.txt"},
 			[]string{},
 		)
 
 		require.NoError(t, err)
-		require.Equal(t, read("test/expected/run-no-tests.txt"), normalizeElapsedText(result.stdout))
+		require.Contains(t, result.stdout, "1) Sub › x (panicked)\n   /home/test/bolt/panic/main_test.go:6\n\n   panic: boom [recovered, repanicked]\n")
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("PanicFullTrace", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--full-trace", "--replay", "test/replays/run-panic.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Contains(t, result.stdout, "goroutine 7 [running]:")
+		require.Contains(t, result.stdout, "    /usr/local/go/src/testing/testing.go:2123 +0x232")
+		require.NotContains(t, result.stdout, "Full goroutine dump hidden")
+	})
+
+	t.Run("TimeoutReplayFile", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-timeout.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-timeout.txt"), normalizeElapsedText(result.stdout))
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("CoverProfileReplayFile", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-coverprofile.txt", "--coverprofile", "test/replays/run-coverprofile.out"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-coverprofile.txt"), normalizeElapsedText(result.stdout))
 		require.Equal(t, 0, result.exitcode)
 	})
 
-	t.Run("JSON", func(t *testing.T) {
-		c.Clock.Now = func() time.Time {
-			t, _ := time.Parse(time.RFC3339, "2023-10-26T14:41:41.05297-07:00")
-			return t
+	t.Run("CoverProfileJSON", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--reporter", "json", "--replay", "test/replays/run-coverprofile.txt", "--coverprofile", "test/replays/run-coverprofile.out"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+
+		var data reporters.JSONData
+		err = json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err)
+
+		require.Equal(t, "github.com/fnando/bolt/test/reference/cov/shapes", data.Coverage[0].Package)
+
+		file := data.Coverage[0].Files[0]
+		require.Equal(t, "github.com/fnando/bolt/test/reference/cov/shapes/main.go", file.File)
+		require.Equal(t, 10, file.Statements)
+		require.Equal(t, 4, file.Covered)
+		require.Equal(t, []c.LineRange{{Start: 18, End: 18}, {Start: 22, End: 22}, {Start: 29, End: 35}}, file.Uncovered)
+
+		require.Equal(t, "(*Square).Validate", file.Functions[1].Name)
+		require.Equal(t, 60.0, file.Functions[1].Coverage)
+		require.Equal(t, []c.LineRange{{Start: 18, End: 18}, {Start: 22, End: 22}}, file.Functions[1].Uncovered)
+	})
+
+	t.Run("IntegrationCoverage", func(t *testing.T) {
+		tempHome(t)
+
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(path.Join(dir, "cmd", "app"), 0755))
+		require.NoError(t, os.MkdirAll(path.Join(dir, "e2e"), 0755))
+		require.NoError(t, os.MkdirAll(path.Join(dir, "greet"), 0755))
+
+		write(t, path.Join(dir, "go.mod"), "module example.com/integration\n\ngo 1.21\n")
+		write(t, path.Join(dir, "greet", "greet.go"), "package greet\n\nfunc Hello() string {\n\treturn \"hello\"\n}\n\nfunc Bye() string {\n\treturn \"bye\"\n}\n")
+		write(t, path.Join(dir, "greet", "greet_test.go"), "package greet\n\nimport \"testing\"\n\nfunc TestHello(t *testing.T) {\n\tif Hello() != \"hello\" {\n\t\tt.Fail()\n\t}\n}\n")
+		write(t, path.Join(dir, "cmd", "app", "main.go"), `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		fmt.Println("hello", os.Args[1])
+		return
+	}
+
+	fmt.Println("hello")
+}
+`)
+		write(t, path.Join(dir, "e2e", "e2e_test.go"), `package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestApp(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "app")
+	out, err := exec.Command("go", "build", "-cover", "-o", bin, "example.com/integration/cmd/app").CombinedOutput()
+
+	if err != nil {
+		t.Fatal(string(out))
+	}
+
+	cmd := exec.Command(bin, "world")
+	cmd.Env = append(os.Environ(), "GOCOVERDIR="+os.Getenv("BOLT_COVERDIR"))
+	out, err = cmd.CombinedOutput()
+
+	if err != nil {
+		t.Fatal(string(out))
+	}
+}
+`)
+
+		result := runIn(t, dir, []string{"run", "--reporter", "json", "./..."})
+		require.Equal(t, 0, result.exitcode, result.stdout)
+
+		var data reporters.JSONData
+		err := json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err, result.stdout)
+
+		var app, greet *c.Coverage
+
+		for _, coverage := range data.Coverage {
+			switch coverage.Package {
+			case "example.com/integration/cmd/app":
+				app = coverage
+			case "example.com/integration/greet":
+				greet = coverage
+			}
 		}
 
+		require.NotNil(t, app)
+		require.Equal(t, 75.0, app.Coverage)
+		require.Equal(t, 0.0, *app.UnitCoverage)
+
+		// Packages that the binary didn't cover aren't merged.
+		require.NotNil(t, greet)
+		require.Equal(t, 50.0, greet.Coverage)
+		require.Nil(t, greet.UnitCoverage)
+		require.Equal(t, []c.LineRange{{Start: 14, End: 14}}, app.Files[0].Uncovered)
+
+		result = runIn(t, dir, []string{"run", "--no-color", "./..."})
+		require.Contains(t, result.stdout, "[75.0%] example.com/integration/cmd/app (unit tests: 0.0%)\n")
+		require.Contains(t, result.stdout, "[50.0%] example.com/integration/greet\n")
+	})
+
+	t.Run("CoverageFormats", func(t *testing.T) {
+		dir := t.TempDir()
+		coberturaPath := path.Join(dir, "coverage.xml")
+		lcovPath := path.Join(dir, "coverage.info")
+
 		result, err := run(
-			[]string{"run", "--reporter", "json", "--replay", "test/replays/run-mixed.txt"},
+			[]string{
+				"run", "--no-color",
+				"--replay", "test/replays/run-coverprofile.txt",
+				"--coverprofile", "test/replays/run-coverprofile.out",
+				"--coverage-format", "cobertura:" + coberturaPath + ",lcov:" + lcovPath,
+			},
 			[]string{},
 		)
 
 		require.NoError(t, err)
+		require.Equal(t, 0, result.exitcode)
+
+		workingDir, _ := os.Getwd()
+		cobertura := strings.Replace(read(coberturaPath), "<source>"+workingDir+"</source>", "<source>/home/test/bolt</source>", 1)
+
+		require.Equal(t, read("test/expected/coverage.xml"), cobertura)
+		require.Equal(t, read("test/expected/coverage.info"), read(lcovPath))
+	})
+
+	t.Run("InvalidCoverageFormat", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--replay", "test/replays/run-coverprofile.txt", "--coverage-format", "html:coverage.html"},
+			[]string{},
+		)
 
-		var data any
-		err = json.Unmarshal([]byte(result.stdout), &data)
 		require.NoError(t, err)
+		require.Contains(t, result.stderr, "Invalid coverage format (html)")
+		require.Equal(t, 1, result.exitcode)
+	})
 
-		require.Contains(t, result.stderr, "exit status 3")
+	t.Run("CoverageGate", func(t *testing.T) {
+		result, err := run(
+			[]string{
+				"run", "--no-color",
+				"--replay", "test/replays/run-coverprofile.txt",
+				"--coverprofile", "test/replays/run-coverprofile.out",
+				"--min-coverage", "50",
+				"--min-package-coverage", "github.com/fnando/bolt/test/reference/cov/letters=70",
+				"--min-total-coverage", "80",
+			},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-coverage-gate.txt"), normalizeElapsedText(result.stdout))
+		require.Contains(t, result.stderr, "exit status 1")
 		require.Equal(t, 1, result.exitcode)
 	})
 
-	t.Run("PostRunCommand", func(t *testing.T) {
-		_, err := run(
-			[]string{"run", "--no-color", "--debug", "--replay", "test/replays/run-mixed.txt", "--post-run-command", "env | grep BOLT | sort > test/tmp/env"},
+	t.Run("CoverageGateJSON", func(t *testing.T) {
+		result, err := run(
+			[]string{
+				"run", "--reporter", "json",
+				"--replay", "test/replays/run-coverprofile.txt",
+				"--min-package-coverage", "github.com/fnando/bolt/test/reference/cov/...=50",
+				"--min-total-coverage", "70",
+			},
 			[]string{},
 		)
 
 		require.NoError(t, err)
+		require.Equal(t, 1, result.exitcode)
 
-		content := read("test/tmp/env")
+		var data reporters.JSONData
+		err = json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err)
 
-		require.Contains(t, content, "BOLT_TEST_COUNT=10\n")
-		require.Contains(t, content, "BOLT_PASS_COUNT=5\n")
-		require.Contains(t, content, "BOLT_FAIL_COUNT=3\n")
-		require.Contains(t, content, "BOLT_SKIP_COUNT=2\n")
-		require.Contains(t, content, "BOLT_BENCHMARK_COUNT=0\n")
-		require.Contains(t, content, "BOLT_SUMMARY=")
-		require.Contains(t, content, "BOLT_TITLE=Failed!\n")
-		require.Contains(t, content, "BOLT_ELAPSED=")
-		require.Contains(t, content, "BOLT_ELAPSED_NANOSECONDS=")
+		// Without a profile, the total is the average of all packages.
+		require.Len(t, data.CoverageGate, 2)
+		require.Equal(t, c.CoverageGateFailure{Scope: "package", Package: "github.com/fnando/bolt/test/reference/cov/shapes", Coverage: 40, Minimum: 50}, data.CoverageGate[0])
+		require.Equal(t, "total", data.CoverageGate[1].Scope)
+		require.InDelta(t, (66.7+100+40)/3, data.CoverageGate[1].Coverage, 0.001)
+	})
+
+	t.Run("CoverageGatePassing", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-coverprofile.txt", "--min-coverage", "40"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.NotContains(t, result.stdout, "Coverage gate failed")
+		require.Equal(t, 0, result.exitcode)
+	})
+
+	t.Run("CoverageGatePostRunCommand", func(t *testing.T) {
+		envPath := path.Join(t.TempDir(), "env")
+
+		result, err := run(
+			[]string{
+				"run", "--no-color",
+				"--replay", "test/replays/run-coverprofile.txt",
+				"--min-coverage", "50",
+				"--post-run-command", "env | grep BOLT_ > " + envPath,
+			},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, 1, result.exitcode)
+
+		content := read(envPath)
+		require.Contains(t, content, "BOLT_TITLE=Failed!")
+		require.Contains(t, content, "BOLT_COVERAGE_GATE_FAILURE_COUNT=1\n")
+		require.Contains(t, content, "BOLT_COVERAGE_GATE_FAILURES=github.com/fnando/bolt/test/reference/cov/shapes: 40.0% is below the minimum of 50.0%\n")
+		require.Regexp(t, "BOLT_SUMMARY=.*, coverage gate failed\n", content)
+	})
+
+	t.Run("CoverageDiff", func(t *testing.T) {
+		tempHome(t)
+
+		dir := t.TempDir()
+		git := func(args ...string) {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=bolt", "-c", "user.email=bolt@example.com"}, args...)...)
+			cmd.Dir = dir
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+		}
+
+		write(t, path.Join(dir, "go.mod"), "module example.com/diffcov\n\ngo 1.21\n")
+		write(t, path.Join(dir, "calc.go"), "package diffcov\n\nfunc Add(a, b int) int {\n\treturn a + b\n}\n")
+		write(t, path.Join(dir, "calc_test.go"), "package diffcov\n\nimport \"testing\"\n\nfunc TestAdd(t *testing.T) {\n\tif Add(1, 2) != 3 {\n\t\tt.Fail()\n\t}\n}\n")
+		git("init", "-q")
+		git("add", "-A")
+		git("commit", "-qm", "base")
+
+		// Only the negative branch of the new function isn't covered.
+		write(t, path.Join(dir, "calc.go"), read(path.Join(dir, "calc.go"))+"\nfunc Sign(n int) string {\n\tif n < 0 {\n\t\treturn \"negative\"\n\t}\n\n\treturn \"positive\"\n}\n")
+		write(t, path.Join(dir, "calc_test.go"), read(path.Join(dir, "calc_test.go"))+"\nfunc TestSign(t *testing.T) {\n\tif Sign(1) != \"positive\" {\n\t\tt.Fail()\n\t}\n}\n")
+
+		result := runIn(t, dir, []string{"run", "--reporter", "json", "--coverage-diff", "HEAD", "--min-diff-coverage", "80", "./..."})
+		require.Equal(t, 1, result.exitcode)
+
+		var data reporters.JSONData
+		err := json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err, result.stdout)
+
+		require.Equal(t, "HEAD", data.DiffCoverage.Ref)
+		require.Equal(t, 3, data.DiffCoverage.Statements)
+		require.Equal(t, 2, data.DiffCoverage.Covered)
+		require.Equal(t, "calc.go", data.DiffCoverage.Files[0].File)
+		require.Equal(t, []c.LineRange{{Start: 9, End: 9}}, data.DiffCoverage.Files[0].Uncovered)
+		require.Equal(t, "diff", data.CoverageGate[0].Scope)
+
+		result = runIn(t, dir, []string{"run", "--no-color", "--coverage-diff", "HEAD", "./..."})
+		require.Equal(t, 0, result.exitcode)
+		require.Contains(t, result.stdout, "Coverage of changes since HEAD:\n\n[66.7%] 2 of 3 changed statements\n  [66.7%] calc.go (uncovered: 9)\n")
+
+		// Files that haven't been added to git count as changed.
+		write(t, path.Join(dir, "mul.go"), "package diffcov\n\nfunc Mul(a, b int) int {\n\treturn a * b\n}\n")
+
+		result = runIn(t, dir, []string{"run", "--reporter", "json", "--coverage-diff", "HEAD", "./..."})
+		require.Equal(t, 0, result.exitcode)
+
+		data = reporters.JSONData{}
+		err = json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err, result.stdout)
+
+		require.Equal(t, 4, data.DiffCoverage.Statements)
+		require.Equal(t, 2, data.DiffCoverage.Covered)
+		require.Equal(t, "mul.go", data.DiffCoverage.Files[1].File)
+		require.Equal(t, []c.LineRange{{Start: 4, End: 4}}, data.DiffCoverage.Files[1].Uncovered)
+	})
+
+	t.Run("Shard", func(t *testing.T) {
+		tempHome(t)
+
+		dir := t.TempDir()
+		write(t, path.Join(dir, "go.mod"), "module example.com/shard\n\ngo 1.21\n")
+
+		for pkg, tests := range map[string][]string{"a": {"A1", "A2", "A3"}, "b": {"B"}, "c": {"C"}} {
+			contents := "package " + pkg + "\n\nimport \"testing\"\n"
+
+			for _, test := range tests {
+				contents += "\nfunc Test" + test + "(t *testing.T) {}\n"
+			}
+
+			require.NoError(t, os.MkdirAll(path.Join(dir, pkg), 0755))
+			write(t, path.Join(dir, pkg, pkg+"_test.go"), contents)
+		}
+
+		timingsPath := path.Join(t.TempDir(), "timings.json")
+
+		runShard := func(args ...string) ([]string, []string) {
+			result := runIn(t, dir, append([]string{"run", "--reporter=json", "--timings=" + timingsPath}, args...))
+			require.Equal(t, 0, result.exitcode, result.stdout)
+
+			var data reporters.JSONData
+			require.NoError(t, json.Unmarshal([]byte(result.stdout), &data), result.stdout)
+
+			packages := []string{}
+			tests := []string{}
+
+			for _, pkg := range data.Packages {
+				packages = append(packages, strings.TrimPrefix(pkg.Name, "example.com/shard/"))
+			}
+
+			for _, test := range data.Tests {
+				tests = append(tests, test.Name)
+			}
+
+			return packages, tests
+		}
+
+		// Without timings, tests are counted.
+		packages, _ := runShard("--shard=1/2", "./...")
+		require.Equal(t, []string{"a"}, packages)
+		packages, _ = runShard("--shard=2/2", "./...")
+		require.Equal(t, []string{"b", "c"}, packages)
+
+		var timings c.Timings
+		require.NoError(t, json.Unmarshal([]byte(read(timingsPath)), &timings))
+		require.Contains(t, timings.Packages["example.com/shard/a"].Tests, "TestA1")
+		require.Contains(t, timings.Packages["example.com/shard/b"].Tests, "TestB")
+
+		// Each shard updates its own timings, so every run starts from the
+		// same file, like CI jobs would.
+		timingsFile := `{"Packages": {"example.com/shard/a": {"Tests": {"TestA1": 1000000, "TestA2": 1000000, "TestA3": 1000000}}, "example.com/shard/b": {"Tests": {"TestB": 10000000000}}, "example.com/shard/c": {"Tests": {"TestC": 1000000000}}}}`
+		write(t, timingsPath, timingsFile)
+		packages, _ = runShard("--shard=1/2", "./...")
+		require.Equal(t, []string{"b"}, packages)
+		write(t, timingsPath, timingsFile)
+		packages, _ = runShard("--shard=2/2", "./...")
+		require.Equal(t, []string{"a", "c"}, packages)
+
+		require.NoError(t, os.Remove(timingsPath))
+		packages, tests := runShard("--shard=1/2", "--shard-tests", "./...")
+		require.Equal(t, []string{"a", "c"}, packages)
+		require.Equal(t, []string{"TestA1", "TestA3", "TestC"}, tests)
+
+		require.NoError(t, os.Remove(timingsPath))
+		packages, tests = runShard("--shard=2/2", "--shard-tests", "./...")
+		require.Equal(t, []string{"a", "b"}, packages)
+		require.Equal(t, []string{"TestA2", "TestB"}, tests)
+
+		result := runIn(t, dir, []string{"run", "--shard=1/2", "--shard-tests", "./...", "--", "-run", "TestA1"})
+		require.Equal(t, 1, result.exitcode)
+		require.Contains(t, result.stdout, "--shard-tests can't be used with -run")
+
+		// Without --shard-tests, packages aren't split and -run is kept.
+		packages, tests = runShard("--shard=1/2", "./...", "--", "-run", "TestA1|TestC")
+		require.Equal(t, []string{"a"}, packages)
+		require.Equal(t, []string{"TestA1"}, tests)
+
+		result = runIn(t, dir, []string{"run", "--shard=3/2"})
+		require.Equal(t, 1, result.exitcode)
+		require.Contains(t, result.stdout, "invalid shard \"3/2\" (must be index/total, e.g. 2/5)")
+	})
+
+	t.Run("Retries", func(t *testing.T) {
+		tempHome(t)
+
+		dir := t.TempDir()
+		write(t, path.Join(dir, "go.mod"), "module example.com/retries\n\ngo 1.21\n")
+		write(t, path.Join(dir, "retries_test.go"), "package retries\n\nimport (\n\t\"os\"\n\t\"testing\"\n)\n\nfunc TestFlaky(t *testing.T) {\n\tdata, _ := os.ReadFile(\"attempts.txt\")\n\tos.WriteFile(\"attempts.txt\", append(data, '.'), 0644)\n\n\tif len(data) == 0 {\n\t\tt.Fatal(\"first attempt\")\n\t}\n}\n\nfunc TestBroken(t *testing.T) {\n\tif os.Getenv(\"BROKEN\") == \"1\" {\n\t\tt.Fatal(\"broken\")\n\t}\n}\n")
+
+		result := runIn(t, dir, []string{"run", "--no-color", "--hide-coverage", "--hide-packages", "--retries=2", "./..."})
+		require.Equal(t, 0, result.exitcode, result.stdout)
+		require.Contains(t, result.stdout, "F.~\n")
+		require.Contains(t, result.stdout, "1) Flaky (flaky, passed on attempt 2)")
+		require.Contains(t, result.stdout, "2 tests, 0 failures, 1 flaky, 0 skips")
+		require.Equal(t, "..", read(path.Join(dir, "attempts.txt")))
+
+		os.Remove(path.Join(dir, "attempts.txt"))
+		t.Setenv("BROKEN", "1")
+
+		result = runIn(t, dir, []string{"run", "--no-color", "--hide-coverage", "--hide-packages", "--retries=2", "./..."})
+		require.Equal(t, 1, result.exitcode, result.stdout)
+		require.Contains(t, result.stdout, "2 tests, 1 failures, 1 flaky, 0 skips")
+	})
+
+	t.Run("FailFast", func(t *testing.T) {
+		tempHome(t)
+
+		dir := t.TempDir()
+		write(t, path.Join(dir, "go.mod"), "module example.com/failfast\n\ngo 1.21\n")
+
+		for _, name := range []string{"a", "b", "c"} {
+			require.NoError(t, os.MkdirAll(path.Join(dir, name), 0755))
+			write(t, path.Join(dir, name, name+"_test.go"), "package "+name+"\n\nimport (\n\t\"testing\"\n\t\"time\"\n)\n\nfunc TestSlow(t *testing.T) {\n\ttime.Sleep(5 * time.Second)\n}\n")
+		}
+
+		write(t, path.Join(dir, "a", "fail_test.go"), "package a\n\nimport \"testing\"\n\nfunc TestFail(t *testing.T) {\n\tt.Fatal(\"boom\")\n}\n")
+
+		result := runIn(t, dir, []string{"run", "--no-color", "--hide-coverage", "--fail-fast", "./...", "--", "-p", "1"})
+		require.Equal(t, 1, result.exitcode, result.stdout)
+		require.Contains(t, result.stdout, "1) Fail\n")
+		require.Contains(t, result.stdout, "Run aborted after the first failure, 2 packages never ran.")
+
+		result = runIn(t, dir, []string{"run", "--reporter", "json", "--fail-fast", "./...", "--", "-p", "1"})
+		require.Equal(t, 1, result.exitcode)
+
+		var data reporters.JSONData
+		require.NoError(t, json.Unmarshal([]byte(result.stdout), &data), result.stdout)
+		require.Equal(t, "fail-fast", data.Aborted)
+		require.Equal(t, []string{"example.com/failfast/b", "example.com/failfast/c"}, data.NotRunPackages)
+	})
+
+	t.Run("Interrupt", func(t *testing.T) {
+		tempHome(t)
+
+		dir := t.TempDir()
+		write(t, path.Join(dir, "go.mod"), "module example.com/interrupt\n\ngo 1.21\n")
+
+		for _, name := range []string{"a", "b"} {
+			require.NoError(t, os.MkdirAll(path.Join(dir, name), 0755))
+			write(t, path.Join(dir, name, name+"_test.go"), "package "+name+"\n\nimport (\n\t\"os\"\n\t\"testing\"\n\t\"time\"\n)\n\nfunc TestSlow(t *testing.T) {\n\tos.WriteFile(\"../started\", nil, 0644)\n\ttime.Sleep(time.Minute)\n}\n")
+		}
+
+		stdout := bytes.NewBufferString("")
+		cmd := exec.Command(build(t), "run", "--no-color", "--hide-coverage", "./...", "--", "-p", "1")
+		cmd.Dir = dir
+		cmd.Stdout = stdout
+		cmd.Stderr = stdout
+		require.NoError(t, cmd.Start())
+
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(path.Join(dir, "started"))
+			return err == nil
+		}, time.Minute, 50*time.Millisecond)
+
+		require.NoError(t, cmd.Process.Signal(os.Interrupt))
+		err := cmd.Wait()
+
+		exiterr, ok := err.(*exec.ExitError)
+		require.True(t, ok, stdout.String())
+		require.Equal(t, 130, exiterr.ExitCode())
+		require.Contains(t, stdout.String(), "Run interrupted, 1 packages never ran.")
+		require.Contains(t, stdout.String(), "Tests running when interrupted:\n  TestSlow (example.com/interrupt/a)\n")
+	})
+
+	t.Run("HangTimeout", func(t *testing.T) {
+		tempHome(t)
+
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(path.Join(dir, "a"), 0755))
+		require.NoError(t, os.MkdirAll(path.Join(dir, "b"), 0755))
+		write(t, path.Join(dir, "go.mod"), "module example.com/hang\n\ngo 1.21\n")
+		write(t, path.Join(dir, "a", "a_test.go"), "package a\n\nimport \"testing\"\n\nfunc TestOk(t *testing.T) {}\n\nfunc TestHang(t *testing.T) {\n\tt.Run(\"forever\", func(t *testing.T) {\n\t\tselect {}\n\t})\n}\n")
+		write(t, path.Join(dir, "b", "b_test.go"), "package b\n\nimport \"testing\"\n\nfunc TestB(t *testing.T) {}\n")
+
+		result := runIn(t, dir, []string{"run", "--no-color", "--hide-coverage", "--hang-timeout=1s", "./...", "--", "-p", "1"})
+		require.Equal(t, 1, result.exitcode, result.stdout)
+		require.Contains(t, result.stdout, "1) Hang › forever (hung)\n")
+		require.Contains(t, result.stdout, "No output for too long, goroutines dumped with SIGQUIT: quit")
+		require.Contains(t, result.stdout, "3 tests, 1 failures")
+
+		result = runIn(t, dir, []string{"run", "--reporter", "json", "--hang-timeout=1s", "./...", "--", "-p", "1"})
+
+		var data reporters.JSONData
+		require.NoError(t, json.Unmarshal([]byte(result.stdout), &data), result.stdout)
+
+		for _, test := range data.Tests {
+			if strings.HasPrefix(test.Name, "TestHang") {
+				require.Equal(t, "fail", test.Status)
+				require.NotNil(t, test.Panic, test.Name)
+				require.True(t, test.Panic.Hung)
+				require.NotEmpty(t, test.Panic.Goroutines)
+			}
+		}
+
+		result = runIn(t, dir, []string{"run", "--hang-timeout=soon"})
+		require.Equal(t, 1, result.exitcode)
+		require.Contains(t, result.stdout, "invalid duration \"soon\"")
+	})
+
+	t.Run("StatusLine", func(t *testing.T) {
+		// script runs bolt in a pseudo-terminal, so the status line is shown.
+		if _, err := exec.LookPath("script"); err != nil || runtime.GOOS != "linux" {
+			t.Skip("script isn't available")
+		}
+
+		tempHome(t)
+
+		dir := t.TempDir()
+		write(t, path.Join(dir, "go.mod"), "module example.com/status\n\ngo 1.21\n")
+		write(t, path.Join(dir, "status_test.go"), "package status\n\nimport (\n\t\"testing\"\n\t\"time\"\n)\n\nfunc TestSlow(t *testing.T) {\n\ttime.Sleep(2 * time.Second)\n}\n")
+
+		command := build(t) + " run --no-color --hide-coverage --hide-packages ./... -- -count=1"
+		cmd := exec.Command("script", "-qec", command, "/dev/null")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "COLUMNS=80", "TERM=xterm")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+
+		require.Regexp(t, `Running: TestSlow \(\ds\) · Packages: 0/1`, string(out))
+		require.Contains(t, string(out), "\033[J")
+		require.Contains(t, string(out), "1 tests, 0 failures")
+
+		// Without a terminal, only the dots are printed.
+		result := runIn(t, dir, []string{"run", "--no-color", "--hide-coverage", "--hide-packages", "./..."})
+		require.NotContains(t, result.stdout, "Packages: ")
+		require.True(t, strings.HasPrefix(result.stdout, ".\n"), result.stdout)
+	})
+
+	t.Run("Instafail", func(t *testing.T) {
+		result, err := run([]string{"run", "--no-color", "--instafail", "--replay", "test/replays/run-fail.txt"}, []string{})
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(result.stdout, "F\n\n1) Equal Number Fail\n"), result.stdout)
+		require.Equal(t, 2, strings.Count(result.stdout, "1) Equal Number Fail\n"))
+
+		// The final report is the same as without --instafail.
+		expected, err := run([]string{"run", "--no-color", "--replay", "test/replays/run-fail.txt"}, []string{})
+		require.NoError(t, err)
+		report := expected.stdout[strings.Index(expected.stdout, "\n"):]
+		require.True(t, strings.HasSuffix(result.stdout, report), result.stdout)
+
+		// Panics are printed after the test fails, so the failure is only
+		// shown once they've been read.
+		result, err = run([]string{"run", "--no-color", "--instafail", "--replay", "test/replays/run-panic-subtest.txt"}, []string{})
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(result.stdout, "F\n\n1) Sub › x (panicked)\n"), result.stdout)
+		require.Equal(t, 2, strings.Count(result.stdout, "   panic: boom [recovered, repanicked]\n"))
+
+		result, err = run([]string{"run", "--no-color", "--instafail", "--reporter", "standard", "--replay", "test/replays/run-fail.txt"}, []string{})
+		require.NoError(t, err)
+		require.Contains(t, result.stdout, "--- FAIL: TestEqualNumberFail")
+		require.Contains(t, result.stdout, "\n1) Equal Number Fail\n")
+		require.Contains(t, result.stdout, "\n3) Equal Struct Fail\n")
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		home := tempHome(t)
+
+		dir := t.TempDir()
+		test := "package failed\n\nimport \"testing\"\n\nvar broken = %v\n\nfunc TestA(t *testing.T) {\n\tt.Run(\"ok\", func(t *testing.T) {})\n\tt.Run(\"bad one\", func(t *testing.T) {\n\t\tif broken {\n\t\t\tt.Fail()\n\t\t}\n\t})\n}\n\nfunc TestB(t *testing.T) {\n\tt.Run(\"ok\", func(t *testing.T) {\n\t\tif broken {\n\t\t\tt.Fail()\n\t\t}\n\t})\n\tt.Run(\"bad one\", func(t *testing.T) {})\n}\n"
+		write(t, path.Join(dir, "go.mod"), "module example.com/failed\n\ngo 1.21\n")
+		write(t, path.Join(dir, "failed_test.go"), fmt.Sprintf(test, true))
+
+		result := runIn(t, dir, []string{"run", "--no-color", "./..."})
+		require.Equal(t, 1, result.exitcode)
+
+		matches, _ := filepath.Glob(path.Join(home, ".bolt", "cache", "*", "last-run.json"))
+		require.Len(t, matches, 1)
+
+		result = runIn(t, dir, []string{"run", "--failed", "--reporter", "json"})
+		require.Equal(t, 1, result.exitcode)
+
+		var data reporters.JSONData
+		err := json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err, result.stdout)
+		// Only the failed subtests run, not the ones of other failed tests
+		// that have the same name.
+		require.Len(t, data.Tests, 4)
+		require.Equal(t, "TestA", data.Tests[0].Name)
+		require.Equal(t, "TestA/bad_one", data.Tests[1].Name)
+		require.Equal(t, "TestB", data.Tests[2].Name)
+		require.Equal(t, "TestB/ok", data.Tests[3].Name)
+
+		write(t, path.Join(dir, "failed_test.go"), fmt.Sprintf(test, false))
+
+		result = runIn(t, dir, []string{"run", "--no-color", "--hide-coverage", "--failed", "--failed-then-all"})
+		require.Equal(t, 0, result.exitcode)
+		require.Contains(t, result.stdout, "2 tests, 0 failures")
+		require.Contains(t, result.stdout, "The failed tests are passing now. Running all tests.")
+		require.Contains(t, result.stdout, "4 tests, 0 failures")
+
+		result = runIn(t, dir, []string{"run", "--failed"})
+		require.Equal(t, 0, result.exitcode)
+		require.Equal(t, "No failed tests from the last run.\n", result.stdout)
+	})
+
+	t.Run("FailedBuildFailure", func(t *testing.T) {
+		tempHome(t)
+
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(path.Join(dir, "a"), 0755))
+		require.NoError(t, os.MkdirAll(path.Join(dir, "b"), 0755))
+		write(t, path.Join(dir, "go.mod"), "module example.com/failed\n\ngo 1.21\n")
+		write(t, path.Join(dir, "a", "a_test.go"), "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {\n\tt.Fail()\n}\n")
+		write(t, path.Join(dir, "b", "b_test.go"), "package b\n\nimport \"testing\"\n\nfunc TestC(t *testing.T) {\n\tundefined()\n}\n")
+
+		result := runIn(t, dir, []string{"run", "--no-color", "./..."})
+		require.Equal(t, 1, result.exitcode)
+
+		write(t, path.Join(dir, "b", "b_test.go"), "package b\n\nimport \"testing\"\n\nfunc TestC(t *testing.T) {\n\tt.Fail()\n}\n")
+
+		// Package b had no failed tests, so it must not get a's -run.
+		result = runIn(t, dir, []string{"run", "--failed", "--reporter", "json"})
+		require.Equal(t, 1, result.exitcode)
+
+		var data reporters.JSONData
+		require.NoError(t, json.Unmarshal([]byte(result.stdout), &data), result.stdout)
+		require.Len(t, data.Tests, 2)
+		require.Equal(t, "TestA", data.Tests[0].Name)
+		require.Equal(t, "fail", data.Tests[0].Status)
+		require.Equal(t, "TestC", data.Tests[1].Name)
+		require.Equal(t, "fail", data.Tests[1].Status)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		dir := t.TempDir()
+		reportPath := path.Join(dir, "report.json")
+
+		result, err := run([]string{"run", "--reporter", "json", "--replay", "test/replays/run-fail.txt"}, []string{})
+		require.NoError(t, err)
+		write(t, reportPath, result.stdout)
+
+		result, err = run([]string{"merge", "--reporter", "json", reportPath, "test/replays/run-subtests.txt"}, []string{})
+		require.NoError(t, err)
+		require.Equal(t, 1, result.exitcode)
+
+		var data reporters.JSONData
+		require.NoError(t, json.Unmarshal([]byte(result.stdout), &data), result.stdout)
+		require.Len(t, data.Packages, 2)
+		require.Equal(t, "github.com/fnando/bolt/test/reference/fail", data.Packages[0].Name)
+		require.Equal(t, 3, data.Packages[0].TestsCount)
+		require.Equal(t, "github.com/fnando/bolt/test/reference/subtests", data.Packages[1].Name)
+
+		result, err = run([]string{"merge", "--no-color", "--hide-coverage", reportPath, "test/replays/run-subtests.txt"}, []string{})
+		require.NoError(t, err)
+		require.Contains(t, result.stdout, "7 tests, 5 failures, 0 skips, 0 benchmarks")
+
+		result, err = run([]string{"merge"}, []string{})
+		require.NoError(t, err)
+		require.Equal(t, 1, result.exitcode)
+		require.Contains(t, result.stderr, "No files to merge")
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		tempHome(t)
+
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(path.Join(dir, "a"), 0755))
+		require.NoError(t, os.MkdirAll(path.Join(dir, "b"), 0755))
+		require.NoError(t, os.MkdirAll(path.Join(dir, "c", "testdata"), 0755))
+		write(t, path.Join(dir, "go.mod"), "module example.com/watch\n\ngo 1.21\n")
+		write(t, path.Join(dir, "a", "a.go"), "package a\n\nfunc A() int {\n\treturn 1\n}\n")
+		write(t, path.Join(dir, "b", "b.go"), "package b\n\nimport \"example.com/watch/a\"\n\nfunc B() int {\n\treturn a.A()\n}\n")
+		write(t, path.Join(dir, "b", "b_test.go"), "package b\n\nimport \"testing\"\n\nfunc TestB(t *testing.T) {\n\tif B() != 1 {\n\t\tt.Fail()\n\t}\n}\n\nfunc TestOther(t *testing.T) {}\n")
+		write(t, path.Join(dir, "c", "c_test.go"), "package c\n\nimport (\n\t\"os\"\n\t\"testing\"\n)\n\nfunc TestC(t *testing.T) {\n\tif _, err := os.ReadFile(\"testdata/input.txt\"); err != nil {\n\t\tt.Fatal(err)\n\t}\n}\n")
+		write(t, path.Join(dir, "c", "testdata", "input.txt"), "hello\n")
+
+		cmd := exec.Command(build(t), "watch", "--no-color", "--hide-coverage", "--interval=50ms")
+		cmd.Dir = dir
+		stdin, err := cmd.StdinPipe()
+		require.NoError(t, err)
+		stdout, err := cmd.StdoutPipe()
+		require.NoError(t, err)
+		cmd.Stderr = cmd.Stdout
+		require.NoError(t, cmd.Start())
+
+		lines := make(chan string)
+
+		go func() {
+			scanner := bufio.NewScanner(stdout)
+
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+
+			close(lines)
+		}()
+
+		// Each run ends with the watch prompt.
+		waitForRun := func() string {
+			out := ""
+			timeout := time.After(time.Minute)
+
+			for {
+				select {
+				case line, ok := <-lines:
+					require.True(t, ok, out)
+					out += line + "\n"
+
+					if strings.HasPrefix(line, "Watching for changes.") {
+						return out
+					}
+				case <-timeout:
+					require.FailNow(t, "watch didn't finish running", out)
+				}
+			}
+		}
+
+		out := waitForRun()
+		require.Contains(t, out, "3 tests, 0 failures")
+
+		// Changing a package also runs the packages that depend on it.
+		write(t, path.Join(dir, "a", "a.go"), "package a\n\nfunc A() int {\n\treturn 10\n}\n")
+		out = waitForRun()
+		require.Contains(t, out, "2 tests, 1 failures")
+		require.Contains(t, out, "| example.com/watch/a |")
+		require.Contains(t, out, "| example.com/watch/b |")
+		require.NotContains(t, out, "| example.com/watch/c |")
+
+		_, err = stdin.Write([]byte("f"))
+		require.NoError(t, err)
+		out = waitForRun()
+		require.Contains(t, out, "1 tests, 1 failures")
+		require.Contains(t, out, "| example.com/watch/b |")
+
+		write(t, path.Join(dir, "c", "testdata", "input.txt"), "hello there\n")
+		out = waitForRun()
+		require.Contains(t, out, "1 tests, 0 failures")
+		require.Contains(t, out, "| example.com/watch/c |")
+
+		_, err = stdin.Write([]byte("q"))
+		require.NoError(t, err)
+		require.NoError(t, cmd.Wait())
+	})
+
+	t.Run("CustomSymbols", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-mixed.txt"},
+			[]string{"BOLT_FAIL_SYMBOL=❌", "BOLT_PASS_SYMBOL=⚡️", "BOLT_SKIP_SYMBOL=😴"},
+		)
+
+		require.NoError(t, err)
+		require.Contains(t, result.stdout, "⚡️⚡️❌❌❌⚡️⚡️⚡️😴😴")
+	})
+
+	t.Run("ColorOutput", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--replay", "test/replays/run-mixed.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(
+			t,
+			read("test/expected/run-mixed-color.txt"),
+			normalizeElapsedText(result.stdout),
+		)
+		require.Contains(t, result.stderr, "exit status 3")
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("CustomColorOutput", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--replay", "test/replays/run-mixed.txt"},
+			[]string{
+				"BOLT_TEXT_COLOR=31",
+				"BOLT_FAIL_COLOR=32",
+				"BOLT_PASS_COLOR=33",
+				"BOLT_SKIP_COLOR=34",
+				"BOLT_DETAIL_COLOR=35",
+			},
+		)
+
+		require.NoError(t, err)
+		require.Equal(
+			t,
+			read("test/expected/run-mixed-custom-color.txt"),
+			normalizeElapsedText(result.stdout),
+		)
+		require.Contains(t, result.stderr, "exit status 3")
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("ReplayError", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--replay", "test/replays/run-error.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-error.txt"), normalizeElapsedText(result.stdout))
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("ReplayUnreadablePath", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-pass.txt/nested"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Contains(t, result.stderr, "not a directory")
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("ReplayBuildFailure", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-build-fail.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-build-fail.txt"), normalizeElapsedText(result.stdout))
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("ReplayFixedBuildFailure", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--hide-coverage", "--replay", "test/replays/run-build-fail.txt,test/replays/run-build-fixed.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.NotContains(t, result.stdout, "Build failures")
+		require.Contains(t, result.stdout, "3 tests, 0 failures")
+		require.Equal(t, 0, result.exitcode)
+	})
+
+	t.Run("ReplayBuildWarning", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-build-warning.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-build-warning.txt"), normalizeElapsedText(result.stdout))
+		require.Equal(t, 0, result.exitcode)
+	})
+
+	t.Run("ReplayBuildFailureJSON", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--reporter", "json", "--replay", "test/replays/run-error.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+
+		var data reporters.JSONData
+		err = json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err)
+
+		require.Len(t, data.BuildFailures, 1)
+		require.Equal(t, "github.com/fnando/bolt/test/reference/fail", data.BuildFailures[0].Package)
+		require.Equal(t, "test/reference/fail/main_test.go:7:2", data.BuildFailures[0].Errors[0].Location())
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("ReplayNoTests", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-no-tests.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-no-tests.txt"), normalizeElapsedText(result.stdout))
+		require.Equal(t, 0, result.exitcode)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		c.Clock.Now = func() time.Time {
+			t, _ := time.Parse(time.RFC3339, "2023-10-26T14:41:41.05297-07:00")
+			return t
+		}
+
+		result, err := run(
+			[]string{"run", "--reporter", "json", "--replay", "test/replays/run-mixed.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+
+		var data any
+		err = json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err)
+
+		require.Contains(t, result.stderr, "exit status 3")
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("PackageFailureWithoutTestFailures", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--reporter", "json", "--replay", "test/replays/run-testmain.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+
+		var data reporters.JSONData
+		err = json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err)
+
+		require.Len(t, data.Packages, 1)
+		require.Equal(t, "fail", data.Packages[0].Status)
+		require.Equal(t, 0, data.Packages[0].FailCount)
+		require.Equal(t, 5*time.Millisecond, data.Packages[0].Elapsed)
+		require.Equal(t, 1, result.exitcode)
+	})
+
+	t.Run("ReplayUsesEventTimings", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--reporter", "json", "--replay", "test/replays/run-pass.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+
+		var data reporters.JSONData
+		err = json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err)
+
+		startedAt, _ := time.Parse(time.RFC3339Nano, "2023-10-31T12:15:22.772950-07:00")
+		endedAt, _ := time.Parse(time.RFC3339Nano, "2023-10-31T12:15:22.773212-07:00")
+
+		require.Equal(t, float64(endedAt.Sub(startedAt)), data.Elapsed)
+		require.Equal(t, "TestEqualNumberPass", data.Tests[0].Name)
+		require.Equal(t, 20*time.Millisecond, data.Tests[0].Elapsed)
+		require.Equal(t, "TestEqualStringPass", data.Tests[1].Name)
+		require.Equal(t, 10*time.Millisecond, data.Tests[1].Elapsed)
+	})
+
+	t.Run("ReplayParallelTests", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--reporter", "json", "--replay", "test/replays/run-parallel.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+
+		var data reporters.JSONData
+		err = json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err)
+
+		pausedAt, _ := time.Parse(time.RFC3339Nano, "2026-10-18T08:41:17.039279991Z")
+		resumedAt, _ := time.Parse(time.RFC3339Nano, "2026-10-18T08:41:17.089856796Z")
+
+		require.Equal(t, "TestParallelFirst", data.Tests[0].Name)
+		require.Equal(t, resumedAt.Sub(pausedAt), data.Tests[0].Paused)
+		require.Equal(t, 20*time.Millisecond, data.Tests[0].Elapsed)
+		require.Equal(t, "TestSequential", data.Tests[2].Name)
+		require.Equal(t, time.Duration(0), data.Tests[2].Paused)
+	})
+
+	t.Run("ReplayOtherActions", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--reporter", "json", "--replay", "test/replays/run-actions.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+
+		var data reporters.JSONData
+		err = json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err)
+
+		require.Equal(t, map[string]string{"issue": "1234"}, data.Tests[0].Attributes)
+		require.Equal(t, "/tmp/artifacts/TestAttributes", data.Tests[0].ArtifactsDir)
+		require.Equal(t, []string{`unknown action "teleport"`}, data.Warnings)
+
+		result, err = run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-actions.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Contains(t, result.stdout, "Warnings:\n  unknown action \"teleport\"\n")
+	})
+
+	t.Run("RecordAndReplay", func(t *testing.T) {
+		recordPath := path.Join(t.TempDir(), "bolt.log")
+
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-fail.txt", "--record", recordPath},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-fail.txt"), normalizeElapsedText(result.stdout))
+
+		header, events, _ := strings.Cut(read(recordPath), "\n")
+		recordHeader, ok := c.ParseRecordHeader(header)
+
+		require.True(t, ok)
+		require.Equal(t, c.Version, recordHeader.BoltVersion)
+		require.Contains(t, recordHeader.GoVersion, "go")
+		require.Contains(t, recordHeader.Args, "test/replays/run-fail.txt")
+		require.Equal(t, read("test/replays/run-fail.txt"), events)
+
+		result, err = run(
+			[]string{"run", "--no-color", "--replay", recordPath},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-fail.txt"), normalizeElapsedText(result.stdout))
+		require.Contains(t, result.stderr, "exit status 3")
+	})
+
+	t.Run("ReplayFromStdin", func(t *testing.T) {
+		result, err := runWithInput(
+			[]string{"run", "--no-color", "--replay", "-"},
+			[]string{},
+			read("test/replays/run-fail.txt"),
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-fail.txt"), normalizeElapsedText(result.stdout))
+		require.Contains(t, result.stderr, "exit status 3")
+	})
+
+	t.Run("ReplayGzipFile", func(t *testing.T) {
+		replayPath := path.Join(t.TempDir(), "run-fail.txt.gz")
+		file, err := os.Create(replayPath)
+		require.NoError(t, err)
+
+		writer := gzip.NewWriter(file)
+		_, err = writer.Write([]byte(read("test/replays/run-fail.txt")))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		require.NoError(t, file.Close())
+
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", replayPath},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, read("test/expected/run-fail.txt"), normalizeElapsedText(result.stdout))
+		require.Contains(t, result.stderr, "exit status 3")
+	})
+
+	t.Run("ReplayMultipleFiles", func(t *testing.T) {
+		result, err := run(
+			[]string{"run", "--reporter", "json", "--replay", "test/replays/run-pass.txt,test/replays/run-skip.txt,test/replays/run-pass.txt"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+
+		var data reporters.JSONData
+		err = json.Unmarshal([]byte(result.stdout), &data)
+		require.NoError(t, err)
+
+		require.Len(t, data.Packages, 2)
+		require.Equal(t, "github.com/fnando/bolt/test/reference/pass", data.Packages[0].Name)
+		require.Equal(t, 2, data.Packages[0].TestsCount)
+		require.Equal(t, "github.com/fnando/bolt/test/reference/skip", data.Packages[1].Name)
+		require.Len(t, data.Coverage, 2)
+		require.Len(t, data.Tests, 4)
+	})
+
+	t.Run("PostRunCommand", func(t *testing.T) {
+		_, err := run(
+			[]string{"run", "--no-color", "--debug", "--replay", "test/replays/run-mixed.txt", "--post-run-command", "env | grep BOLT | sort > test/tmp/env"},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+
+		content := read("test/tmp/env")
+
+		require.Contains(t, content, "BOLT_TEST_COUNT=10\n")
+		require.Contains(t, content, "BOLT_PASS_COUNT=5\n")
+		require.Contains(t, content, "BOLT_FAIL_COUNT=3\n")
+		require.Contains(t, content, "BOLT_SKIP_COUNT=2\n")
+		require.Contains(t, content, "BOLT_BENCHMARK_COUNT=0\n")
+		require.Contains(t, content, "BOLT_EXAMPLE_COUNT=0\n")
+		require.Contains(t, content, "BOLT_FUZZ_COUNT=0\n")
+		require.Contains(t, content, "BOLT_SUMMARY=")
+		require.Contains(t, content, "BOLT_TITLE=Failed!\n")
+		require.Contains(t, content, "BOLT_STATUS=fail\n")
+		require.Contains(t, content, "BOLT_ELAPSED=")
+		require.Contains(t, content, "BOLT_ELAPSED_NANOSECONDS=")
+	})
+
+	t.Run("PostRunCommandFailedPackage", func(t *testing.T) {
+		env := filepath.Join(t.TempDir(), "env")
+
+		result, err := run(
+			[]string{"run", "--no-color", "--replay", "test/replays/run-testmain.txt", "--post-run-command", "env | grep BOLT | sort > " + env},
+			[]string{},
+		)
+
+		require.NoError(t, err)
+		require.Equal(t, 1, result.exitcode)
+
+		content := read(env)
+
+		require.Contains(t, content, "BOLT_FAIL_COUNT=0\n")
+		require.Contains(t, content, "BOLT_TITLE=Failed!\n")
+		require.Contains(t, content, "BOLT_STATUS=fail\n")
 	})
 }
@@ -10,21 +10,39 @@ import (
 
 type Aggregation struct {
 	BenchmarksMap     map[string]*Benchmark
+	BuildFailuresMap  map[string]*BuildFailure
 	CoverageCount     int
+	CoverageGate      CoverageGate
+	DiffCoverage      *DiffCoverage
 	CoverageMap       map[string]*Coverage
 	CoverageThreshold float64
 	OrphanOutput      []string
+	PackagesMap       map[string]*Package
 	SlowestCount      int
 	SlowestThreshold  time.Duration
 	TestsMap          map[string]*Test
+	Warnings          []string
+	// Aborted is the reason why the run stopped early (e.g. "fail-fast"), and
+	// NotRunPackages the packages that never ran because of it.
+	Aborted        string
+	NotRunPackages []string
 
 	StartedAt time.Time
 	EndedAt   time.Time
+
+	buildPackage string
+	buildOutput  []buildOutputLine
 }
 
 type Coverage struct {
 	Package  string
 	Coverage float64
+	Files    []*FileCoverage `json:",omitempty"`
+	// UnitCoverage is set when integration coverage has been merged, and
+	// holds the coverage reported by go test.
+	UnitCoverage *float64 `json:",omitempty"`
+
+	measured bool
 }
 
 func (agg Aggregation) Elapsed() time.Duration {
@@ -32,7 +50,7 @@ func (agg Aggregation) Elapsed() time.Duration {
 }
 
 func (agg Aggregation) TestsCount() int {
-	return len(agg.Tests())
+	return len(agg.ReportableTests())
 }
 
 func (agg Aggregation) Benchmarks() []*Benchmark {
@@ -45,6 +63,26 @@ func (agg Aggregation) Benchmarks() []*Benchmark {
 	return benchmarks
 }
 
+func (agg Aggregation) Packages() []*Package {
+	packages := maps.Values(agg.PackagesMap)
+
+	slices.SortFunc(packages, func(a, b *Package) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return packages
+}
+
+func (agg Aggregation) BuildFailures() []*BuildFailure {
+	failures := maps.Values(agg.BuildFailuresMap)
+
+	slices.SortFunc(failures, func(a, b *BuildFailure) int {
+		return cmp.Compare(a.Package, b.Package)
+	})
+
+	return failures
+}
+
 func (agg Aggregation) Tests() []*Test {
 	tests := maps.Values(agg.TestsMap)
 
@@ -59,10 +97,36 @@ func (agg Aggregation) Tests() []*Test {
 	return tests
 }
 
-func (agg Aggregation) SlowestTests() []*Test {
+func (agg Aggregation) ReportableTests() []*Test {
 	tests := []*Test{}
 
 	for _, test := range agg.Tests() {
+		if test.Reportable() {
+			tests = append(tests, test)
+		}
+	}
+
+	return tests
+}
+
+// TestTree returns the top-level tests of each package. Subtests can be
+// reached through Test.Children.
+func (agg Aggregation) TestTree() map[string][]*Test {
+	tree := map[string][]*Test{}
+
+	for _, test := range agg.Tests() {
+		if test.Parent == nil {
+			tree[test.Package] = append(tree[test.Package], test)
+		}
+	}
+
+	return tree
+}
+
+func (agg Aggregation) SlowestTests() []*Test {
+	tests := []*Test{}
+
+	for _, test := range agg.ReportableTests() {
 		if int64(test.Elapsed) > int64(agg.SlowestThreshold) {
 			tests = append(tests, test)
 		}
@@ -83,7 +147,9 @@ func (agg Aggregation) Coverages() []*Coverage {
 	coverages := []*Coverage{}
 
 	for _, coverage := range maps.Values(agg.CoverageMap) {
-		if coverage.Coverage < agg.CoverageThreshold {
+		_, buildFailed := agg.BuildFailuresMap[coverage.Package]
+
+		if !buildFailed && coverage.Coverage < agg.CoverageThreshold {
 			coverages = append(coverages, coverage)
 		}
 	}
@@ -103,10 +169,28 @@ func (agg Aggregation) Coverages() []*Coverage {
 	return coverages
 }
 
+// AllCoverages returns the coverage of every package, regardless of the
+// threshold, sorted by package.
+func (agg Aggregation) AllCoverages() []*Coverage {
+	coverages := []*Coverage{}
+
+	for _, coverage := range agg.CoverageMap {
+		if _, buildFailed := agg.BuildFailuresMap[coverage.Package]; !buildFailed {
+			coverages = append(coverages, coverage)
+		}
+	}
+
+	slices.SortFunc(coverages, func(a, b *Coverage) int {
+		return cmp.Compare(a.Package, b.Package)
+	})
+
+	return coverages
+}
+
 func (agg Aggregation) CountBy(status string) int {
 	count := 0
 
-	for _, test := range agg.Tests() {
+	for _, test := range agg.ReportableTests() {
 		if status == test.Status {
 			count += 1
 		}
@@ -115,8 +199,74 @@ func (agg Aggregation) CountBy(status string) int {
 	return count
 }
 
+// CountByKind counts top-level tests only, so a fuzz target is counted once
+// regardless of how many inputs it ran.
+func (agg Aggregation) CountByKind(kind string) int {
+	count := 0
+
+	for _, test := range agg.Tests() {
+		if test.Parent == nil && kind == test.Kind {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+// FailedPackagesCount counts packages that failed without any failing test, like
+// when TestMain exits with a non-zero code.
+func (agg Aggregation) FailedPackagesCount() int {
+	count := 0
+
+	for _, pkg := range agg.PackagesMap {
+		_, buildFailed := agg.BuildFailuresMap[pkg.Name]
+
+		if pkg.Status == "fail" && pkg.FailCount == 0 && !buildFailed {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+// MarkFlaky flags a failed test that passed when retried, along with its
+// failed subtests. The package passes once all its failures are flaky.
+func (agg Aggregation) MarkFlaky(test *Test, attempts int) {
+	pkg := agg.PackagesMap[test.Package]
+
+	var mark func(test *Test)
+	mark = func(test *Test) {
+		if test.Status != "fail" {
+			return
+		}
+
+		if test.Reportable() && pkg != nil {
+			pkg.FailCount -= 1
+			pkg.FlakyCount += 1
+		}
+
+		test.Status = "flaky"
+		test.Attempts = attempts
+
+		for _, child := range test.Children {
+			mark(child)
+		}
+	}
+
+	mark(test)
+
+	if pkg != nil && pkg.Status == "fail" && pkg.FailCount == 0 {
+		pkg.Status = "pass"
+	}
+}
+
 func (agg Aggregation) Status() string {
-	if agg.CountBy("fail") > 0 {
+	if agg.Aborted == "interrupted" {
+		return "interrupted"
+	} else if agg.CountBy("fail") > 0 ||
+		len(agg.BuildFailuresMap) > 0 ||
+		agg.FailedPackagesCount() > 0 ||
+		len(agg.CoverageGateFailures()) > 0 {
 		return "fail"
 	} else if agg.CountBy("skip") > 0 {
 		return "skip"
@@ -124,3 +274,17 @@ func (agg Aggregation) Status() string {
 
 	return "pass"
 }
+
+// InterruptedTests returns the tests that were still running when their
+// package stopped.
+func (agg Aggregation) InterruptedTests() []*Test {
+	tests := []*Test{}
+
+	for _, test := range agg.Tests() {
+		if test.interrupted {
+			tests = append(tests, test)
+		}
+	}
+
+	return tests
+}
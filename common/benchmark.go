@@ -0,0 +1,77 @@
+package common
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Benchmark struct {
+	Name                    string
+	Package                 string
+	Key                     string `json:"-"`
+	Processors              int
+	Iterations              int
+	DurationPerOperation    time.Duration
+	BytesPerOperation       int64
+	AllocationsPerOperation int64
+	Metrics                 map[string]float64
+
+	pending string
+}
+
+var benchmarkResultRegex = regexp.MustCompile(`^\S+?(?:-(\d+))?\s+(\d+)\s+(.+)$`)
+var benchmarkMetricRegex = regexp.MustCompile(`^([\d.eE+-]+)\s+(\S+)$`)
+
+// Newer go versions print the benchmark name before running it and the
+// results once it's done, so the line may come in multiple events.
+func (benchmark *Benchmark) processOutput(output string) {
+	output = benchmark.pending + output
+
+	if !strings.HasSuffix(output, "\n") {
+		benchmark.pending = output
+		return
+	}
+
+	benchmark.pending = ""
+	matches := benchmarkResultRegex.FindStringSubmatch(strings.TrimSpace(output))
+
+	if matches == nil {
+		return
+	}
+
+	benchmark.Processors = 1
+
+	if matches[1] != "" {
+		benchmark.Processors, _ = strconv.Atoi(matches[1])
+	}
+
+	benchmark.Iterations, _ = strconv.Atoi(matches[2])
+	benchmark.Metrics = map[string]float64{}
+
+	for _, field := range strings.Split(matches[3], "\t") {
+		metric := benchmarkMetricRegex.FindStringSubmatch(strings.TrimSpace(field))
+
+		if metric == nil {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(metric[1], 64)
+
+		if err != nil {
+			continue
+		}
+
+		benchmark.Metrics[metric[2]] = value
+
+		switch metric[2] {
+		case "ns/op":
+			benchmark.DurationPerOperation = time.Duration(value)
+		case "B/op":
+			benchmark.BytesPerOperation = int64(value)
+		case "allocs/op":
+			benchmark.AllocationsPerOperation = int64(value)
+		}
+	}
+}
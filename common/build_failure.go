@@ -0,0 +1,133 @@
+package common
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type BuildFailure struct {
+	Package string
+	Errors  []BuildError
+	Output  []string
+}
+
+type BuildError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+var buildHeaderRegex = regexp.MustCompile(`^# (\S+)(?: \[.*\])?$`)
+var buildFailedRegex = regexp.MustCompile(`^FAIL\s+(\S+) \[(?:build|setup) failed\]$`)
+var buildErrorRegex = regexp.MustCompile(`^(.+?\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+type buildOutputLine struct {
+	pkg    string
+	line   string
+	header bool
+}
+
+// processBuildOutput handles compiler output, which comes either as plain
+// text lines (older go versions) or as build-output events. The import path
+// may be empty for plain text lines, in which case the last "# package"
+// header is used. Lines are held back until the build fails, as the compiler
+// may also print warnings (e.g. from the linker) for packages that build.
+func (consumer StreamConsumer) processBuildOutput(importPath string, line string) bool {
+	line = strings.TrimRight(line, "\r\n")
+
+	if matches := buildFailedRegex.FindStringSubmatch(line); matches != nil {
+		consumer.failBuild(matches[1])
+		consumer.Aggregation.buildPackage = ""
+
+		return true
+	}
+
+	header := false
+
+	if matches := buildHeaderRegex.FindStringSubmatch(line); matches != nil {
+		consumer.Aggregation.buildPackage = matches[1]
+		header = true
+	}
+
+	pkg := strings.Fields(importPath + " " + consumer.Aggregation.buildPackage)
+
+	if len(pkg) == 0 {
+		return false
+	}
+
+	consumer.Aggregation.buildOutput = append(
+		consumer.Aggregation.buildOutput,
+		buildOutputLine{pkg: pkg[0], line: line, header: header},
+	)
+
+	return true
+}
+
+// failBuild records the build failure of a package, along with the compiler
+// output that has been held back for it.
+func (consumer StreamConsumer) failBuild(pkg string) *BuildFailure {
+	failure := consumer.buildFailure(pkg)
+	pending := []buildOutputLine{}
+
+	for _, output := range consumer.Aggregation.buildOutput {
+		if output.pkg != pkg {
+			pending = append(pending, output)
+			continue
+		}
+
+		if output.header {
+			continue
+		}
+
+		failure.Output = append(failure.Output, output.line)
+
+		if matches := buildErrorRegex.FindStringSubmatch(output.line); matches != nil {
+			lineNumber, _ := strconv.Atoi(matches[2])
+			column, _ := strconv.Atoi(matches[3])
+
+			failure.Errors = append(failure.Errors, BuildError{
+				File:    matches[1],
+				Line:    lineNumber,
+				Column:  column,
+				Message: matches[4],
+			})
+		}
+	}
+
+	consumer.Aggregation.buildOutput = pending
+
+	return failure
+}
+
+// flushBuildOutput moves compiler output of packages that didn't fail to
+// build to the orphan output.
+func (consumer StreamConsumer) flushBuildOutput() {
+	for _, output := range consumer.Aggregation.buildOutput {
+		consumer.Aggregation.OrphanOutput = append(consumer.Aggregation.OrphanOutput, output.line)
+	}
+
+	consumer.Aggregation.buildOutput = nil
+}
+
+func (consumer StreamConsumer) buildFailure(pkg string) *BuildFailure {
+	failure, exists := consumer.Aggregation.BuildFailuresMap[pkg]
+
+	if !exists {
+		failure = &BuildFailure{Package: pkg}
+		consumer.Aggregation.BuildFailuresMap[pkg] = failure
+	}
+
+	return failure
+}
+
+func (buildError BuildError) Location() string {
+	location := buildError.File + ":" + strconv.Itoa(buildError.Line)
+
+	if buildError.Column > 0 {
+		location += ":" + strconv.Itoa(buildError.Column)
+	}
+
+	return location
+}
@@ -10,11 +10,13 @@ type color struct {
 }
 
 var defaultColors map[string]string = map[string]string{
-	"text":   "30",
-	"fail":   "31",
-	"pass":   "32",
-	"skip":   "33",
-	"detail": "34",
+	"text":        "30",
+	"fail":        "31",
+	"pass":        "32",
+	"skip":        "33",
+	"detail":      "34",
+	"flaky":       "35",
+	"interrupted": "33",
 }
 
 func (c color) Apply(code string, text string) string {
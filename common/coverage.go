@@ -0,0 +1,533 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+type FileCoverage struct {
+	File       string
+	Coverage   float64
+	Statements int
+	Covered    int
+	Uncovered  []LineRange
+	Functions  []*FunctionCoverage `json:",omitempty"`
+
+	blocks []ProfileBlock
+	path   string
+}
+
+type FunctionCoverage struct {
+	Name       string
+	Line       int
+	EndLine    int
+	Coverage   float64
+	Statements int
+	Covered    int
+	Uncovered  []LineRange
+}
+
+type LineCoverage struct {
+	Line int
+	Hits int
+}
+
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// ProfileBlock is a line from a coverage profile, e.g.
+// pkg/file.go:12.2,14.16 2 1
+type ProfileBlock struct {
+	File       string
+	StartLine  int
+	StartCol   int
+	EndLine    int
+	EndCol     int
+	Statements int
+	Count      int
+}
+
+var profileBlockRegex = regexp.MustCompile(`^(.+):(\d+)\.(\d+),(\d+)\.(\d+) (\d+) (\d+)$`)
+
+// ParseCoverProfile reads files created by "go test -coverprofile" or "go
+// tool covdata textfmt". The same block may be listed more than once (e.g.
+// when using -coverpkg or multiple profiles), so counts are added up.
+func ParseCoverProfile(profilePaths ...string) ([]ProfileBlock, error) {
+	blocks := map[string]*ProfileBlock{}
+
+	for _, profilePath := range profilePaths {
+		err := parseCoverProfile(profilePath, blocks)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list := []ProfileBlock{}
+
+	for _, block := range blocks {
+		list = append(list, *block)
+	}
+
+	slices.SortFunc(list, func(a, b ProfileBlock) int {
+		if a.File != b.File {
+			return cmp.Compare(a.File, b.File)
+		}
+
+		if a.StartLine != b.StartLine {
+			return cmp.Compare(a.StartLine, b.StartLine)
+		}
+
+		return cmp.Compare(a.StartCol, b.StartCol)
+	})
+
+	return list, nil
+}
+
+func parseCoverProfile(profilePath string, blocks map[string]*ProfileBlock) error {
+	file, err := os.Open(profilePath)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		matches := profileBlockRegex.FindStringSubmatch(line)
+
+		if matches == nil {
+			return errors.New("invalid coverage profile line: " + line)
+		}
+
+		numbers := []int{}
+
+		for _, match := range matches[2:] {
+			number, _ := strconv.Atoi(match)
+			numbers = append(numbers, number)
+		}
+
+		key := strings.TrimSuffix(line, " "+matches[7])
+
+		if block, exists := blocks[key]; exists {
+			block.Count += numbers[5]
+			continue
+		}
+
+		blocks[key] = &ProfileBlock{
+			File:       matches[1],
+			StartLine:  numbers[0],
+			StartCol:   numbers[1],
+			EndLine:    numbers[2],
+			EndCol:     numbers[3],
+			Statements: numbers[4],
+			Count:      numbers[5],
+		}
+	}
+
+	return scanner.Err()
+}
+
+// LoadCoverProfile adds per-file and per-function coverage to the packages
+// listed in the profile. Functions are only available when the source files
+// can be found. Additional profiles (e.g. from integration tests) are merged,
+// in which case the package coverage is recalculated.
+func (agg *Aggregation) LoadCoverProfile(profilePath string, additionalProfilePaths ...string) error {
+	blocks, err := ParseCoverProfile(append([]string{profilePath}, additionalProfilePaths...)...)
+
+	if err != nil {
+		return err
+	}
+
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	files := map[string]*FileCoverage{}
+
+	for _, block := range blocks {
+		file, exists := files[block.File]
+
+		if !exists {
+			file = &FileCoverage{File: block.File}
+			files[block.File] = file
+		}
+
+		file.blocks = append(file.blocks, block)
+	}
+
+	// Only packages with counters from the additional profiles are merged,
+	// even though those may list every package of the binaries with -cover.
+	mergedPackages := map[string]bool{}
+
+	if len(additionalProfilePaths) > 0 {
+		additionalBlocks, err := ParseCoverProfile(additionalProfilePaths...)
+
+		if err != nil {
+			return err
+		}
+
+		for _, block := range additionalBlocks {
+			if block.Count > 0 {
+				mergedPackages[path.Dir(block.File)] = true
+			}
+		}
+	}
+
+	dirs := packageDirs(maps.Keys(files))
+
+	for _, file := range files {
+		file.Statements, file.Covered, file.Uncovered = summarizeBlocks(file.blocks)
+		file.Coverage = percentage(file.Covered, file.Statements)
+
+		if dir, exists := dirs[path.Dir(file.File)]; exists {
+			file.path = filepath.Join(dir, path.Base(file.File))
+			file.Functions = functionsCoverage(file.path, file.blocks)
+		}
+
+		pkg := path.Dir(file.File)
+		coverage, exists := agg.CoverageMap[pkg]
+
+		if !exists {
+			coverage = &Coverage{Package: pkg}
+			agg.CoverageMap[pkg] = coverage
+		}
+
+		coverage.Files = append(coverage.Files, file)
+		coverage.measured = true
+	}
+
+	for _, coverage := range agg.CoverageMap {
+		slices.SortFunc(coverage.Files, func(a, b *FileCoverage) int {
+			return cmp.Compare(a.File, b.File)
+		})
+
+		// Packages that only show up in the profile (e.g. using -coverpkg)
+		// don't have a "coverage:" line.
+		_, tested := agg.PackagesMap[coverage.Package]
+		merged := mergedPackages[coverage.Package] && len(coverage.Files) > 0
+
+		if merged && tested {
+			unitCoverage := coverage.Coverage
+			coverage.UnitCoverage = &unitCoverage
+		}
+
+		if !tested || merged {
+			statements, covered := 0, 0
+
+			for _, file := range coverage.Files {
+				statements += file.Statements
+				covered += file.Covered
+			}
+
+			coverage.Coverage = percentage(covered, statements)
+		}
+	}
+
+	return nil
+}
+
+// CoverDirProfile converts the counters written to GOCOVERDIR by binaries
+// built with "go build -cover" into a text profile. Returns false when
+// there's nothing to convert.
+func CoverDirProfile(coverDir string, profilePath string) (bool, error) {
+	entries, err := os.ReadDir(coverDir)
+
+	if err != nil || len(entries) == 0 {
+		return false, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", "tool", "covdata", "textfmt", "-i="+coverDir, "-o="+profilePath)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+
+	if err != nil {
+		return false, errors.New(strings.TrimSpace(stderr.String()))
+	}
+
+	return true, nil
+}
+
+// packageDirs maps import paths to directories. Packages that can't be found
+// (e.g. when replaying on a different machine) are left out.
+func packageDirs(files []string) map[string]string {
+	dirs := map[string]string{}
+	args := []string{"list", "-e", "-f", "{{.ImportPath}}\t{{.Dir}}"}
+
+	for _, file := range files {
+		if pkg := path.Dir(file); !slices.Contains(args, pkg) {
+			args = append(args, pkg)
+		}
+	}
+
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), "GOPROXY=off")
+	out, err := cmd.Output()
+
+	if err != nil {
+		return dirs
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		pkg, dir, _ := strings.Cut(line, "\t")
+
+		if dir != "" {
+			dirs[pkg] = dir
+		}
+	}
+
+	return dirs
+}
+
+func functionsCoverage(filePath string, blocks []ProfileBlock) []*FunctionCoverage {
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, filePath, nil, 0)
+
+	if err != nil {
+		return nil
+	}
+
+	functions := []*FunctionCoverage{}
+
+	for _, decl := range node.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+
+		if !ok || funcDecl.Body == nil {
+			continue
+		}
+
+		start := fset.Position(funcDecl.Pos())
+		end := fset.Position(funcDecl.End())
+		functionBlocks := []ProfileBlock{}
+
+		for _, block := range blocks {
+			startsAfter := block.StartLine > start.Line ||
+				(block.StartLine == start.Line && block.StartCol >= start.Column)
+			endsBefore := block.EndLine < end.Line ||
+				(block.EndLine == end.Line && block.EndCol <= end.Column)
+
+			if startsAfter && endsBefore {
+				functionBlocks = append(functionBlocks, block)
+			}
+		}
+
+		function := &FunctionCoverage{Name: funcName(funcDecl), Line: start.Line, EndLine: end.Line}
+		function.Statements, function.Covered, function.Uncovered = summarizeBlocks(functionBlocks)
+		function.Coverage = percentage(function.Covered, function.Statements)
+
+		functions = append(functions, function)
+	}
+
+	return functions
+}
+
+// funcName returns names like "Describe" or "(*Square).Area".
+func funcName(funcDecl *ast.FuncDecl) string {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+		return funcDecl.Name.Name
+	}
+
+	expr := funcDecl.Recv.List[0].Type
+	pointer := ""
+
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+		pointer = "*"
+	}
+
+	switch typeExpr := expr.(type) {
+	case *ast.IndexExpr:
+		expr = typeExpr.X
+	case *ast.IndexListExpr:
+		expr = typeExpr.X
+	}
+
+	name := "?"
+
+	if ident, ok := expr.(*ast.Ident); ok {
+		name = ident.Name
+	}
+
+	if pointer != "" {
+		return "(" + pointer + name + ")." + funcDecl.Name.Name
+	}
+
+	return name + "." + funcDecl.Name.Name
+}
+
+// summarizeBlocks counts the statements and merges the uncovered blocks into
+// line ranges. Blocks that aren't separated by covered ones are merged.
+func summarizeBlocks(blocks []ProfileBlock) (statements int, covered int, uncovered []LineRange) {
+	uncovered = []LineRange{}
+	merge := false
+
+	for _, block := range blocks {
+		statements += block.Statements
+
+		if block.Count > 0 {
+			covered += block.Statements
+			merge = false
+
+			continue
+		}
+
+		endLine := block.lastLine()
+
+		if merge {
+			uncovered[len(uncovered)-1].End = max(uncovered[len(uncovered)-1].End, endLine)
+		} else {
+			uncovered = append(uncovered, LineRange{Start: block.StartLine, End: endLine})
+		}
+
+		merge = true
+	}
+
+	return statements, covered, uncovered
+}
+
+// LeastCoveredFiles returns the files below the threshold, starting with
+// the least covered ones.
+func (coverage Coverage) LeastCoveredFiles(threshold float64, count int) []*FileCoverage {
+	files := []*FileCoverage{}
+
+	for _, file := range coverage.Files {
+		if file.Coverage < threshold {
+			files = append(files, file)
+		}
+	}
+
+	slices.SortStableFunc(files, func(a, b *FileCoverage) int {
+		return cmp.Compare(a.Coverage, b.Coverage)
+	})
+
+	return files[:min(len(files), count)]
+}
+
+// LeastCoveredFunctions returns the functions below the threshold, starting
+// with the least covered ones.
+func (file FileCoverage) LeastCoveredFunctions(threshold float64, count int) []*FunctionCoverage {
+	functions := []*FunctionCoverage{}
+
+	for _, function := range file.Functions {
+		if function.Coverage < threshold {
+			functions = append(functions, function)
+		}
+	}
+
+	slices.SortStableFunc(functions, func(a, b *FunctionCoverage) int {
+		return cmp.Compare(a.Coverage, b.Coverage)
+	})
+
+	return functions[:min(len(functions), count)]
+}
+
+// Lines returns the hits of each line that has statements. When blocks
+// share a line, the highest count is used.
+func (file FileCoverage) Lines() []LineCoverage {
+	hits := map[int]int{}
+
+	for _, block := range file.blocks {
+		for line := block.StartLine; line <= block.lastLine(); line++ {
+			hits[line] = max(hits[line], block.Count)
+		}
+	}
+
+	lines := []LineCoverage{}
+
+	for _, line := range maps.Keys(hits) {
+		lines = append(lines, LineCoverage{Line: line, Hits: hits[line]})
+	}
+
+	slices.SortFunc(lines, func(a, b LineCoverage) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+
+	return lines
+}
+
+// Path returns the file's location on disk, or an empty string when the
+// package's directory couldn't be found.
+func (file FileCoverage) Path() string {
+	return file.path
+}
+
+// lastLine ignores the line with the closing brace, as blocks end right
+// before it, which is usually the first column of the next line.
+func (block ProfileBlock) lastLine() int {
+	if block.EndCol <= 1 && block.EndLine > block.StartLine {
+		return block.EndLine - 1
+	}
+
+	return block.EndLine
+}
+
+func percentage(covered int, statements int) float64 {
+	if statements == 0 {
+		return 100.0
+	}
+
+	return float64(covered) / float64(statements) * 100
+}
+
+func (lineRange LineRange) String() string {
+	if lineRange.Start == lineRange.End {
+		return strconv.Itoa(lineRange.Start)
+	}
+
+	return fmt.Sprintf("%d-%d", lineRange.Start, lineRange.End)
+}
+
+// AppendCoverProfile appends the blocks of a profile to another one, which is
+// created if needed.
+func AppendCoverProfile(profilePath string, otherProfilePath string) error {
+	contents, err := os.ReadFile(otherProfilePath)
+
+	if err != nil {
+		return err
+	}
+
+	stat, err := os.Stat(profilePath)
+
+	if err == nil && stat.Size() > 0 {
+		_, blocks, _ := strings.Cut(string(contents), "\n")
+		contents = []byte(blocks)
+	}
+
+	file, err := os.OpenFile(profilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	_, err = file.Write(contents)
+
+	return err
+}
@@ -0,0 +1,173 @@
+package common
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+type CoverageGate struct {
+	Minimum         float64
+	PackageMinimums map[string]float64
+	TotalMinimum    float64
+	DiffMinimum     float64
+}
+
+type CoverageGateFailure struct {
+	// Scope is either "package", "total" or "diff". Package is only set for
+	// the "package" scope.
+	Scope    string
+	Package  string `json:",omitempty"`
+	Coverage float64
+	Minimum  float64
+}
+
+// ParsePackageMinimums parses values like "pkg=80,other/...=50". Patterns
+// can use "/..." like go commands do, or wildcards like "*".
+func ParsePackageMinimums(value string) (map[string]float64, error) {
+	minimums := map[string]float64{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		pattern, minimum, found := strings.Cut(entry, "=")
+		percent, err := strconv.ParseFloat(minimum, 64)
+
+		if !found || err != nil {
+			return nil, fmt.Errorf("invalid package coverage minimum (%s); use pattern=percent", entry)
+		}
+
+		minimums[pattern] = percent
+	}
+
+	return minimums, nil
+}
+
+// packageMinimum returns the minimum set for the package. The longest
+// matching pattern wins over shorter ones and over the global minimum.
+func (gate CoverageGate) packageMinimum(pkg string) (float64, bool) {
+	minimum := gate.Minimum
+	matched := ""
+
+	for pattern, percent := range gate.PackageMinimums {
+		if matchPackage(pattern, pkg) && len(pattern) > len(matched) {
+			minimum = percent
+			matched = pattern
+		}
+	}
+
+	return minimum, matched != "" || gate.Minimum > 0
+}
+
+func matchPackage(pattern string, pkg string) bool {
+	if prefix, found := strings.CutSuffix(pattern, "/..."); found {
+		return pkg == prefix || strings.HasPrefix(pkg, prefix+"/")
+	}
+
+	matched, _ := path.Match(pattern, pkg)
+
+	return matched
+}
+
+// TotalCoverage uses the number of statements from the coverage profile. When
+// there's no profile, the average of all packages is used instead.
+func (agg Aggregation) TotalCoverage() (float64, bool) {
+	statements, covered := 0, 0
+	percentSum, measured := 0.0, 0
+
+	for _, coverage := range agg.CoverageMap {
+		if _, buildFailed := agg.BuildFailuresMap[coverage.Package]; buildFailed || !coverage.measured {
+			continue
+		}
+
+		percentSum += coverage.Coverage
+		measured += 1
+
+		for _, file := range coverage.Files {
+			statements += file.Statements
+			covered += file.Covered
+		}
+	}
+
+	if statements > 0 {
+		return percentage(covered, statements), true
+	}
+
+	if measured > 0 {
+		return percentSum / float64(measured), true
+	}
+
+	return 0, false
+}
+
+// CoverageGateFailures lists packages below their minimum coverage, followed
+// by the total and the changed lines coverage, if below their minimums.
+// Packages without coverage information (e.g. no statements or build
+// failures) are skipped.
+func (agg Aggregation) CoverageGateFailures() []CoverageGateFailure {
+	failures := []CoverageGateFailure{}
+
+	for _, coverage := range agg.CoverageMap {
+		if _, buildFailed := agg.BuildFailuresMap[coverage.Package]; buildFailed || !coverage.measured {
+			continue
+		}
+
+		minimum, exists := agg.CoverageGate.packageMinimum(coverage.Package)
+
+		if exists && coverage.Coverage < minimum {
+			failures = append(failures, CoverageGateFailure{
+				Scope:    "package",
+				Package:  coverage.Package,
+				Coverage: coverage.Coverage,
+				Minimum:  minimum,
+			})
+		}
+	}
+
+	slices.SortFunc(failures, func(a, b CoverageGateFailure) int {
+		return cmp.Compare(a.Package, b.Package)
+	})
+
+	total, measured := agg.TotalCoverage()
+
+	if measured && agg.CoverageGate.TotalMinimum > 0 && total < agg.CoverageGate.TotalMinimum {
+		failures = append(failures, CoverageGateFailure{
+			Scope:    "total",
+			Coverage: total,
+			Minimum:  agg.CoverageGate.TotalMinimum,
+		})
+	}
+
+	diff := agg.DiffCoverage
+
+	if diff != nil && diff.Statements > 0 && diff.Coverage < agg.CoverageGate.DiffMinimum {
+		failures = append(failures, CoverageGateFailure{
+			Scope:    "diff",
+			Coverage: diff.Coverage,
+			Minimum:  agg.CoverageGate.DiffMinimum,
+		})
+	}
+
+	return failures
+}
+
+func (failure CoverageGateFailure) String() string {
+	name := failure.Package
+
+	switch failure.Scope {
+	case "total":
+		name = "total"
+	case "diff":
+		name = "changed lines"
+	}
+
+	return fmt.Sprintf("%s: %.1f%% is below the minimum of %.1f%%", name, failure.Coverage, failure.Minimum)
+}
@@ -0,0 +1,216 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+type DiffCoverage struct {
+	Ref        string
+	Coverage   float64
+	Statements int
+	Covered    int
+	Files      []*DiffFileCoverage
+}
+
+type DiffFileCoverage struct {
+	// File is relative to the repository's root.
+	File       string
+	Coverage   float64
+	Statements int
+	Covered    int
+	Uncovered  []LineRange
+}
+
+var diffFileRegex = regexp.MustCompile(`^\+\+\+ (?:b/)?(.+)$`)
+var diffHunkRegex = regexp.MustCompile(`^@@ -\S+ \+(\d+)(?:,(\d+))? @@`)
+
+// LoadDiffCoverage crosses the lines changed since ref with the coverage
+// profile, which must have been loaded already. Uncommitted changes and
+// untracked files are included, and the diff starts at the merge base, so
+// changes made to ref after branching off don't count.
+func (agg *Aggregation) LoadDiffCoverage(ref string) error {
+	root, err := git("rev-parse", "--show-toplevel")
+
+	if err != nil {
+		return err
+	}
+
+	base, err := git("merge-base", ref, "HEAD")
+
+	if err != nil {
+		base = ref
+	}
+
+	diff, err := git("diff", "--unified=0", "--no-color", "--no-ext-diff", strings.TrimSpace(base))
+
+	if err != nil {
+		return err
+	}
+
+	root = strings.TrimSpace(root)
+	changes := parseDiff(diff)
+
+	// New files that haven't been staged don't show up in the diff, so all of
+	// their lines count as changed.
+	untracked, err := git("-C", root, "ls-files", "--others", "--exclude-standard", "-z")
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range strings.Split(untracked, "\x00") {
+		if !strings.HasSuffix(file, ".go") {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(root, file))
+
+		if err != nil {
+			continue
+		}
+
+		for line := 1; line <= strings.Count(string(content), "\n")+1; line++ {
+			changes[file] = append(changes[file], line)
+		}
+	}
+
+	root, _ = filepath.EvalSymlinks(root)
+	diffCoverage := &DiffCoverage{Ref: ref, Files: []*DiffFileCoverage{}}
+
+	for _, coverage := range agg.CoverageMap {
+		for _, file := range coverage.Files {
+			if file.path == "" {
+				continue
+			}
+
+			filePath, _ := filepath.EvalSymlinks(file.path)
+			relativePath, err := filepath.Rel(root, filePath)
+			changedLines, changed := changes[filepath.ToSlash(relativePath)]
+
+			if err != nil || !changed {
+				continue
+			}
+
+			diffFile := &DiffFileCoverage{File: filepath.ToSlash(relativePath), Uncovered: []LineRange{}}
+
+			for _, block := range file.blocks {
+				lines := changedLinesWithin(changedLines, block.StartLine, block.lastLine())
+
+				if len(lines) == 0 {
+					continue
+				}
+
+				diffFile.Statements += block.Statements
+
+				if block.Count > 0 {
+					diffFile.Covered += block.Statements
+					continue
+				}
+
+				for _, line := range lines {
+					last := len(diffFile.Uncovered) - 1
+
+					if last >= 0 && diffFile.Uncovered[last].End >= line-1 {
+						diffFile.Uncovered[last].End = max(diffFile.Uncovered[last].End, line)
+					} else {
+						diffFile.Uncovered = append(diffFile.Uncovered, LineRange{Start: line, End: line})
+					}
+				}
+			}
+
+			if diffFile.Statements == 0 {
+				continue
+			}
+
+			diffFile.Coverage = percentage(diffFile.Covered, diffFile.Statements)
+			diffCoverage.Statements += diffFile.Statements
+			diffCoverage.Covered += diffFile.Covered
+			diffCoverage.Files = append(diffCoverage.Files, diffFile)
+		}
+	}
+
+	slices.SortFunc(diffCoverage.Files, func(a, b *DiffFileCoverage) int {
+		return cmp.Compare(a.File, b.File)
+	})
+
+	diffCoverage.Coverage = percentage(diffCoverage.Covered, diffCoverage.Statements)
+	agg.DiffCoverage = diffCoverage
+
+	return nil
+}
+
+// parseDiff returns the added or modified lines of each file, sorted.
+func parseDiff(diff string) map[string][]int {
+	changes := map[string][]int{}
+	file := ""
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if matches := diffFileRegex.FindStringSubmatch(line); matches != nil {
+			file = matches[1]
+
+			if file == "/dev/null" {
+				file = ""
+			}
+
+			continue
+		}
+
+		matches := diffHunkRegex.FindStringSubmatch(line)
+
+		if matches == nil || file == "" {
+			continue
+		}
+
+		start, _ := strconv.Atoi(matches[1])
+		count := 1
+
+		if matches[2] != "" {
+			count, _ = strconv.Atoi(matches[2])
+		}
+
+		for line := start; line < start+count; line++ {
+			changes[file] = append(changes[file], line)
+		}
+	}
+
+	return changes
+}
+
+func changedLinesWithin(changedLines []int, start int, end int) []int {
+	lines := []int{}
+
+	for _, line := range changedLines {
+		if line >= start && line <= end {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+func git(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+
+	if err != nil && stderr.Len() > 0 {
+		return "", errors.New(strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), err
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// LastRun holds the failures of the last run of a project, so they can be
+// run again with --failed.
+type LastRun struct {
+	Failures []*LastRunFailure
+}
+
+type LastRunFailure struct {
+	Package string
+	// Tests has the full name of the failed tests, including subtests. It's
+	// empty when the package failed without a failing test (e.g. build
+	// failures).
+	Tests []string `json:",omitempty"`
+}
+
+func NewLastRun(agg *Aggregation) LastRun {
+	failures := map[string]*LastRunFailure{}
+
+	failure := func(pkg string) *LastRunFailure {
+		if _, exists := failures[pkg]; !exists {
+			failures[pkg] = &LastRunFailure{Package: pkg}
+		}
+
+		return failures[pkg]
+	}
+
+	for _, test := range agg.Tests() {
+		if test.Status == "fail" {
+			failure(test.Package).Tests = append(failure(test.Package).Tests, test.Name)
+		}
+	}
+
+	for _, buildFailure := range agg.BuildFailures() {
+		failure(buildFailure.Package)
+	}
+
+	for _, pkg := range agg.Packages() {
+		if pkg.Status == "fail" {
+			failure(pkg.Name)
+		}
+	}
+
+	lastRun := LastRun{Failures: []*LastRunFailure{}}
+	packages := maps.Keys(failures)
+	slices.Sort(packages)
+
+	for _, pkg := range packages {
+		lastRun.Failures = append(lastRun.Failures, failures[pkg])
+	}
+
+	return lastRun
+}
+
+// CacheDir returns the directory where bolt keeps the files of the project
+// in the working dir.
+func CacheDir(homeDir string, workingDir string) string {
+	sum := sha256.Sum256([]byte(workingDir))
+	project := filepath.Base(workingDir) + "-" + hex.EncodeToString(sum[:])[0:12]
+
+	return filepath.Join(homeDir, ".bolt", "cache", project)
+}
+
+// LastRunPath returns the file where the last run of the project in the
+// working dir is saved.
+func LastRunPath(homeDir string, workingDir string) string {
+	return filepath.Join(CacheDir(homeDir, workingDir), "last-run.json")
+}
+
+func LoadLastRun(path string) (LastRun, error) {
+	lastRun := LastRun{}
+	contents, err := os.ReadFile(path)
+
+	if err != nil {
+		return lastRun, err
+	}
+
+	err = json.Unmarshal(contents, &lastRun)
+
+	return lastRun, err
+}
+
+func (lastRun LastRun) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	contents, _ := json.MarshalIndent(lastRun, "", "  ")
+
+	return os.WriteFile(path, contents, 0644)
+}
+
+func (lastRun LastRun) Packages() []string {
+	packages := []string{}
+
+	for _, failure := range lastRun.Failures {
+		packages = append(packages, failure.Package)
+	}
+
+	return packages
+}
+
+// RunPattern returns a -run pattern that only matches the failed tests. go
+// test splits the pattern by top-level "|" and matches each alternative by
+// subtest level, so every failed test has its own alternative (e.g.
+// ^TestA$/^x$|^TestB$/^y$). Tests with failed subtests are left out, so their
+// passing subtests don't run again. It's empty when no tests failed.
+func (lastRun LastRun) RunPattern() string {
+	names := []string{}
+
+	for _, failure := range lastRun.Failures {
+		names = append(names, failure.Tests...)
+	}
+
+	alternatives := []string{}
+
+	for _, name := range names {
+		hasFailedSubtests := slices.ContainsFunc(names, func(other string) bool {
+			return strings.HasPrefix(other, name+"/")
+		})
+
+		if hasFailedSubtests {
+			continue
+		}
+
+		parts := []string{}
+
+		for _, part := range strings.Split(name, "/") {
+			parts = append(parts, "^"+regexp.QuoteMeta(part)+"$")
+		}
+
+		alternative := strings.Join(parts, "/")
+
+		if !slices.Contains(alternatives, alternative) {
+			alternatives = append(alternatives, alternative)
+		}
+	}
+
+	slices.Sort(alternatives)
+
+	return strings.Join(alternatives, "|")
+}
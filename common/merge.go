@@ -0,0 +1,136 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// jsonReport mirrors the output of the JSON reporter. Coverage only lists
+// the least covered packages, so the other ones are taken from Packages.
+type jsonReport struct {
+	Coverage      []*Coverage
+	Packages      []*Package
+	Tests         []*Test
+	Benchmarks    []*Benchmark
+	BuildFailures []*BuildFailure
+	OrphanOutput  []string
+	Warnings      []string
+	Elapsed       time.Duration
+}
+
+// ParseJSONReport reads the output of the JSON reporter, so it can be merged
+// with other runs.
+func ParseJSONReport(contents []byte) (*Aggregation, error) {
+	report := jsonReport{}
+	err := json.Unmarshal(contents, &report)
+
+	if err != nil {
+		return nil, err
+	}
+
+	agg := &Aggregation{
+		TestsMap:         map[string]*Test{},
+		CoverageMap:      map[string]*Coverage{},
+		BenchmarksMap:    map[string]*Benchmark{},
+		BuildFailuresMap: map[string]*BuildFailure{},
+		PackagesMap:      map[string]*Package{},
+		OrphanOutput:     report.OrphanOutput,
+		Warnings:         report.Warnings,
+	}
+
+	// Parents have shorter names than their subtests, so they're added first.
+	slices.SortStableFunc(report.Tests, func(a, b *Test) int {
+		return len(a.Name) - len(b.Name)
+	})
+
+	for _, test := range report.Tests {
+		test.Key = test.Package + ":" + test.Name
+		test.Parent = (StreamConsumer{Aggregation: agg}).findParent(test.Package, test.Name)
+
+		if test.Parent != nil {
+			test.Parent.Children = append(test.Parent.Children, test)
+		}
+
+		agg.TestsMap[test.Key] = test
+
+		if agg.EndedAt.IsZero() || test.EndedAt.After(agg.EndedAt) {
+			agg.EndedAt = test.EndedAt
+		}
+	}
+
+	if !agg.EndedAt.IsZero() {
+		agg.StartedAt = agg.EndedAt.Add(-report.Elapsed)
+	}
+
+	for _, pkg := range report.Packages {
+		agg.PackagesMap[pkg.Name] = pkg
+
+		if pkg.Coverage > 0 {
+			agg.CoverageMap[pkg.Name] = &Coverage{Package: pkg.Name, Coverage: pkg.Coverage, measured: true}
+		}
+	}
+
+	for _, coverage := range report.Coverage {
+		coverage.measured = true
+		agg.CoverageMap[coverage.Package] = coverage
+	}
+
+	for _, benchmark := range report.Benchmarks {
+		benchmark.Key = benchmark.Package + ":" + benchmark.Name
+		agg.BenchmarksMap[benchmark.Key] = benchmark
+	}
+
+	for _, buildFailure := range report.BuildFailures {
+		agg.BuildFailuresMap[buildFailure.Package] = buildFailure
+	}
+
+	return agg, nil
+}
+
+// Merge adds the results of another run, like the one of a different CI job.
+// Packages present in both runs are replaced by the other run.
+func (agg *Aggregation) Merge(other *Aggregation) {
+	for name := range other.PackagesMap {
+		agg.removePackage(name)
+	}
+
+	for key, test := range other.TestsMap {
+		agg.TestsMap[key] = test
+	}
+
+	for key, benchmark := range other.BenchmarksMap {
+		agg.BenchmarksMap[key] = benchmark
+	}
+
+	for name, pkg := range other.PackagesMap {
+		agg.PackagesMap[name] = pkg
+	}
+
+	for name, coverage := range other.CoverageMap {
+		agg.CoverageMap[name] = coverage
+	}
+
+	for name, buildFailure := range other.BuildFailuresMap {
+		agg.BuildFailuresMap[name] = buildFailure
+	}
+
+	agg.OrphanOutput = append(agg.OrphanOutput, other.OrphanOutput...)
+
+	for _, warning := range other.Warnings {
+		if !slices.Contains(agg.Warnings, warning) {
+			agg.Warnings = append(agg.Warnings, warning)
+		}
+	}
+
+	// Jobs run in parallel, so the elapsed time goes from the first one that
+	// started to the last one that finished.
+	if !other.StartedAt.IsZero() && (agg.StartedAt.IsZero() || other.StartedAt.Before(agg.StartedAt)) {
+		agg.StartedAt = other.StartedAt
+	}
+
+	if other.EndedAt.After(agg.EndedAt) {
+		agg.EndedAt = other.EndedAt
+	}
+}
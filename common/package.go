@@ -0,0 +1,109 @@
+package common
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Package struct {
+	Name        string
+	Status      string
+	Elapsed     time.Duration
+	Cached      bool
+	NoTestFiles bool
+	Coverage    float64
+	TestsCount  int
+	PassCount   int
+	FailCount   int
+	SkipCount   int
+	FlakyCount  int
+	Output      []string
+}
+
+var packageCachedRegex = regexp.MustCompile(`^ok\s+\S+\s+\(cached\)`)
+var packageNoTestFilesRegex = regexp.MustCompile(`^\?\s+\S+\s+\[no test files\]`)
+
+func (consumer StreamConsumer) pkg(name string) *Package {
+	pkg, exists := consumer.Aggregation.PackagesMap[name]
+
+	if !exists {
+		pkg = &Package{Name: name}
+		consumer.Aggregation.PackagesMap[name] = pkg
+	}
+
+	return pkg
+}
+
+// resetPackage discards the results of a package that already finished, so
+// the same package showing up again (e.g. when replaying multiple files) is
+// only reported once, using its last run.
+func (consumer StreamConsumer) resetPackage(name string) {
+	pkg, exists := consumer.Aggregation.PackagesMap[name]
+
+	if !exists || pkg.Status == "" {
+		return
+	}
+
+	consumer.Aggregation.removePackage(name)
+}
+
+func (agg *Aggregation) removePackage(name string) {
+	for key, test := range agg.TestsMap {
+		if test.Package == name {
+			delete(agg.TestsMap, key)
+		}
+	}
+
+	for key, benchmark := range agg.BenchmarksMap {
+		if benchmark.Package == name {
+			delete(agg.BenchmarksMap, key)
+		}
+	}
+
+	delete(agg.CoverageMap, name)
+	delete(agg.PackagesMap, name)
+	delete(agg.BuildFailuresMap, name)
+}
+
+func (consumer StreamConsumer) processPackageOutput(stream Stream) {
+	pkg := consumer.pkg(stream.Package)
+	output := strings.TrimRight(stream.Output, "\r\n")
+	pkg.Output = append(pkg.Output, output)
+
+	if packageCachedRegex.MatchString(output) {
+		pkg.Cached = true
+	}
+
+	if packageNoTestFilesRegex.MatchString(output) {
+		pkg.NoTestFiles = true
+	}
+}
+
+func (pkg *Package) count(test *Test) {
+	pkg.TestsCount += 1
+
+	switch test.Status {
+	case "pass":
+		pkg.PassCount += 1
+	case "fail":
+		pkg.FailCount += 1
+	case "skip":
+		pkg.SkipCount += 1
+	}
+}
+
+// ListPackages returns the import paths of the packages matching the patterns.
+// Build args (e.g. -tags) are used when listing packages.
+func ListPackages(patterns []string, buildArgs []string) ([]string, error) {
+	args := append([]string{"list", "-e"}, buildArgs...)
+	out, err := exec.Command("go", append(args, patterns...)...).Output()
+
+	if err != nil {
+		return nil, fmt.Errorf("can't list packages: %v", err)
+	}
+
+	return strings.Fields(string(out)), nil
+}
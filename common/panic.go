@@ -0,0 +1,224 @@
+package common
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Panic struct {
+	Message  string
+	TimedOut bool
+	// Hung is set when the goroutines were dumped with SIGQUIT, which bolt
+	// sends to tests that don't output anything for --hang-timeout.
+	Hung         bool     `json:",omitempty"`
+	RunningTests []string `json:",omitempty"`
+	Goroutines   []Goroutine
+	Output       []string
+}
+
+type Goroutine struct {
+	ID     int
+	State  string
+	Frames []StackFrame
+}
+
+type StackFrame struct {
+	Function  string
+	File      string
+	Line      int
+	CreatedBy bool
+}
+
+var goroutineRegex = regexp.MustCompile(`^goroutine (\d+) (?:.* )?\[(.*?)\]:$`)
+var stackFileRegex = regexp.MustCompile(`^\s+(.+?):(\d+)(?: \+0x[0-9a-f]+)?(?: fp=\S+ sp=\S+ pc=\S+)?$`)
+var runningTestRegex = regexp.MustCompile(`^\s+(\S+) \(.+?\)$`)
+
+const sigquitMessage = "SIGQUIT: quit"
+
+// processPanicOutput captures everything from "panic:" until the end of the
+// test's output, which includes the goroutine dump. Returns true when the
+// line was consumed.
+func (consumer StreamConsumer) processPanicOutput(test *Test, output string) bool {
+	if test.Panic == nil {
+		if !strings.HasPrefix(output, "panic: ") && output != sigquitMessage {
+			return false
+		}
+
+		message := strings.TrimPrefix(output, "panic: ")
+		test.Panic = &Panic{
+			Message:  message,
+			TimedOut: strings.HasPrefix(message, "test timed out after"),
+			Hung:     output == sigquitMessage,
+		}
+
+		// A panic in a subtest is printed after its parent fails, so it's
+		// attributed to the parent. The subtest that failed last is the one
+		// that panicked.
+		if subtest := lastFailedSubtest(test); subtest != nil && subtest.Panic == nil && !test.Panic.Hung {
+			subtest.Panic = test.Panic
+		}
+	}
+
+	test.Panic.Output = append(test.Panic.Output, output)
+
+	return true
+}
+
+func lastFailedSubtest(test *Test) *Test {
+	var last *Test
+
+	for _, child := range test.Children {
+		if child.Status == "fail" && (last == nil || !child.EndedAt.Before(last.EndedAt)) {
+			last = child
+		}
+	}
+
+	if last != nil && len(last.Children) > 0 {
+		if subtest := lastFailedSubtest(last); subtest != nil {
+			return subtest
+		}
+	}
+
+	return last
+}
+
+// parse extracts the running tests and goroutines from the raw output. It
+// can be called multiple times, as the output may grow after the test has
+// been marked as finished.
+func (p *Panic) parse() {
+	p.Message = strings.TrimPrefix(p.Output[0], "panic: ")
+	p.RunningTests = []string{}
+	p.Goroutines = []Goroutine{}
+	section := "message"
+
+	// The SIGQUIT message is followed by registers, not by a message.
+	if p.Hung {
+		section = ""
+	}
+
+	for _, line := range p.Output[1:] {
+		matches := goroutineRegex.FindStringSubmatch(line)
+
+		if matches != nil {
+			id, _ := strconv.Atoi(matches[1])
+			p.Goroutines = append(p.Goroutines, Goroutine{ID: id, State: matches[2]})
+			section = "goroutine"
+
+			continue
+		}
+
+		switch {
+		case strings.TrimSpace(line) == "running tests:":
+			section = "running"
+
+		case strings.TrimSpace(line) == "":
+			if section == "running" {
+				section = ""
+			}
+
+		case section == "message":
+			p.Message += "\n" + line
+
+		case section == "running":
+			if matches := runningTestRegex.FindStringSubmatch(line); matches != nil {
+				p.RunningTests = append(p.RunningTests, matches[1])
+			}
+
+		case section == "goroutine" && !strings.HasPrefix(line, "..."):
+			goroutine := &p.Goroutines[len(p.Goroutines)-1]
+
+			if matches := stackFileRegex.FindStringSubmatch(line); matches != nil {
+				if len(goroutine.Frames) > 0 {
+					frame := &goroutine.Frames[len(goroutine.Frames)-1]
+					frame.File = matches[1]
+					frame.Line, _ = strconv.Atoi(matches[2])
+				}
+
+				continue
+			}
+
+			frame := StackFrame{}
+
+			if strings.HasPrefix(line, "created by ") {
+				frame.CreatedBy = true
+				line = strings.TrimPrefix(line, "created by ")
+				line, _, _ = strings.Cut(line, " in goroutine ")
+			}
+
+			// Drop the arguments, e.g. pkg.(*T).Run(0x1, 0x2) becomes pkg.(*T).Run
+			if index := strings.LastIndex(line, "("); index > 0 && strings.HasSuffix(line, ")") {
+				line = line[:index]
+			}
+
+			frame.Function = line
+			goroutine.Frames = append(goroutine.Frames, frame)
+		}
+	}
+}
+
+// UserFrames returns the frames that belong to the code being tested,
+// skipping the standard library and the generated test main. For timeouts and
+// hangs, the goroutine running the given test is used; otherwise, the
+// goroutine that panicked.
+func (p *Panic) UserFrames(pkg string, testName string) []StackFrame {
+	rootName, _, _ := strings.Cut(testName, "/")
+
+	for _, goroutine := range p.Goroutines {
+		frames := []StackFrame{}
+		runsTest := false
+
+		for _, frame := range goroutine.Frames {
+			if frame.IsUserCode(pkg) && !frame.CreatedBy {
+				frames = append(frames, frame)
+			}
+
+			if strings.HasSuffix(frame.Function, "."+rootName) ||
+				strings.Contains(frame.Function, "."+rootName+".") {
+				runsTest = true
+			}
+		}
+
+		if (!(p.TimedOut || p.Hung) || runsTest) && len(frames) > 0 {
+			return frames
+		}
+	}
+
+	return []StackFrame{}
+}
+
+// IsUserCode returns false for the standard library and the generated test
+// main. Code is considered to be the user's when it belongs to the same
+// module root as the package being tested (which covers modules without a
+// dot, like "myapp"), or when its import path has a dot in its first element.
+func (frame StackFrame) IsUserCode(pkg string) bool {
+	if frame.Function == "main.main" || strings.HasSuffix(frame.File, "_testmain.go") {
+		return false
+	}
+
+	root, _, _ := strings.Cut(pkg, "/")
+	firstElement, _, _ := strings.Cut(frame.Package(), "/")
+
+	if root != "" && strings.TrimSuffix(firstElement, "_test") == root {
+		return true
+	}
+
+	return strings.Contains(firstElement, ".") && strings.Contains(frame.Function, "/")
+}
+
+// Package returns the import path of the frame's function, e.g.
+// example.com/app.(*T).Run becomes example.com/app.
+func (frame StackFrame) Package() string {
+	slash := strings.LastIndex(frame.Function, "/")
+	dot := strings.Index(frame.Function[slash+1:], ".")
+
+	if dot < 0 {
+		return frame.Function
+	}
+
+	return frame.Function[:slash+1+dot]
+}
+
+func (frame StackFrame) Location() string {
+	return frame.File + ":" + strconv.Itoa(frame.Line)
+}
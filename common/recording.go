@@ -0,0 +1,46 @@
+package common
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+)
+
+// RecordHeader is the first line of a file created with --record. It's a
+// JSON object that doesn't look like a go test event, so replaying the file
+// can skip it.
+type RecordHeader struct {
+	BoltVersion string
+	GoVersion   string
+	Args        []string
+	GoTestArgs  []string `json:",omitempty"`
+}
+
+func NewRecordHeader(args []string, goTestArgs []string) RecordHeader {
+	goVersion := "unknown"
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+
+	if err == nil {
+		goVersion = strings.TrimSpace(string(out))
+	}
+
+	return RecordHeader{
+		BoltVersion: Version,
+		GoVersion:   goVersion,
+		Args:        args,
+		GoTestArgs:  goTestArgs,
+	}
+}
+
+func ParseRecordHeader(line string) (RecordHeader, bool) {
+	var header RecordHeader
+	err := json.Unmarshal([]byte(line), &header)
+
+	return header, err == nil && header.BoltVersion != ""
+}
+
+func (header RecordHeader) String() string {
+	contents, _ := json.Marshal(header)
+
+	return string(contents)
+}
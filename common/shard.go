@@ -0,0 +1,252 @@
+package common
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+type Shard struct {
+	Index int
+	Total int
+}
+
+// ShardPackage is a package assigned to a shard. Tests is empty when the
+// whole package runs in the shard.
+type ShardPackage struct {
+	Package string
+	Tests   []string
+}
+
+type shardUnit struct {
+	Package string
+	Test    string
+	Weight  time.Duration
+}
+
+type shardLoad struct {
+	Weight time.Duration
+	Units  []shardUnit
+}
+
+// Tests without timings weigh the same when there are no timings at all,
+// which means the split is done by counting tests.
+const defaultTestWeight = time.Second
+const minTestWeight = time.Millisecond
+
+func ParseShard(value string) (Shard, error) {
+	index, total, found := strings.Cut(value, "/")
+	shard := Shard{}
+	var indexErr, totalErr error
+
+	shard.Index, indexErr = strconv.Atoi(index)
+	shard.Total, totalErr = strconv.Atoi(total)
+
+	if !found || indexErr != nil || totalErr != nil || shard.Total < 1 || shard.Index < 1 || shard.Index > shard.Total {
+		return shard, errors.New("invalid shard " + strconv.Quote(value) + " (must be index/total, e.g. 2/5)")
+	}
+
+	return shard, nil
+}
+
+// Plan splits the packages matching the patterns across shards, so each shard
+// takes about the same time. Tests without timings weigh as much as the
+// average test. With splitTests, the tests of packages bigger than a shard are
+// split as well. The split is deterministic, so every shard computes the same
+// plan. Build args (e.g. -tags) are used when listing packages.
+func (shard Shard) Plan(patterns []string, buildArgs []string, timings Timings, splitTests bool) ([]ShardPackage, error) {
+	tests, err := listTests(patterns, buildArgs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	average := timings.Average()
+
+	if average == 0 {
+		average = defaultTestWeight
+	}
+
+	weight := func(pkg string, test string) time.Duration {
+		elapsed, exists := timings.Test(pkg, test)
+
+		if !exists {
+			elapsed = average
+		}
+
+		return max(elapsed, minTestWeight)
+	}
+
+	packages := maps.Keys(tests)
+	slices.Sort(packages)
+	total := time.Duration(0)
+	packageWeights := map[string]time.Duration{}
+
+	for _, pkg := range packages {
+		for _, test := range tests[pkg] {
+			packageWeights[pkg] += weight(pkg, test)
+		}
+
+		total += packageWeights[pkg]
+	}
+
+	units := []shardUnit{}
+
+	for _, pkg := range packages {
+		split := splitTests &&
+			len(tests[pkg]) > 1 &&
+			packageWeights[pkg] > total/time.Duration(shard.Total)
+
+		if !split {
+			units = append(units, shardUnit{Package: pkg, Weight: packageWeights[pkg]})
+			continue
+		}
+
+		for _, test := range tests[pkg] {
+			units = append(units, shardUnit{Package: pkg, Test: test, Weight: weight(pkg, test)})
+		}
+	}
+
+	// Heaviest units go first, each one to the lightest shard.
+	slices.SortStableFunc(units, func(a, b shardUnit) int {
+		return cmp.Compare(b.Weight, a.Weight)
+	})
+
+	loads := make([]*shardLoad, shard.Total)
+
+	for index := range loads {
+		loads[index] = &shardLoad{}
+	}
+
+	for _, unit := range units {
+		lightest := loads[0]
+
+		for _, load := range loads[1:] {
+			if load.Weight < lightest.Weight ||
+				(load.Weight == lightest.Weight && len(load.Units) < len(lightest.Units)) {
+				lightest = load
+			}
+		}
+
+		lightest.Weight += unit.Weight
+		lightest.Units = append(lightest.Units, unit)
+	}
+
+	assigned := map[string]*ShardPackage{}
+
+	for _, unit := range loads[shard.Index-1].Units {
+		if _, exists := assigned[unit.Package]; !exists {
+			assigned[unit.Package] = &ShardPackage{Package: unit.Package}
+		}
+
+		if unit.Test != "" {
+			assigned[unit.Package].Tests = append(assigned[unit.Package].Tests, unit.Test)
+		}
+	}
+
+	result := []ShardPackage{}
+
+	for _, pkg := range packages {
+		shardPackage, exists := assigned[pkg]
+
+		if !exists {
+			continue
+		}
+
+		if len(shardPackage.Tests) == len(tests[pkg]) {
+			shardPackage.Tests = nil
+		}
+
+		slices.Sort(shardPackage.Tests)
+		result = append(result, *shardPackage)
+	}
+
+	return result, nil
+}
+
+// listTests returns the top-level tests of each package, found by parsing the
+// test files, so nothing has to be compiled.
+func listTests(patterns []string, buildArgs []string) (map[string][]string, error) {
+	args := []string{"list", "-e", "-f", "{{.ImportPath}}\t{{.Dir}}\t{{join .TestGoFiles \" \"}} {{join .XTestGoFiles \" \"}}"}
+	args = append(args, buildArgs...)
+	out, err := exec.Command("go", append(args, patterns...)...).Output()
+
+	if err != nil {
+		return nil, fmt.Errorf("can't list packages: %v", err)
+	}
+
+	tests := map[string][]string{}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.Split(line, "\t")
+
+		if len(parts) != 3 {
+			continue
+		}
+
+		tests[parts[0]] = []string{}
+
+		for _, file := range strings.Fields(parts[2]) {
+			tests[parts[0]] = append(tests[parts[0]], testFunctions(filepath.Join(parts[1], file))...)
+		}
+
+		slices.Sort(tests[parts[0]])
+	}
+
+	return tests, nil
+}
+
+func testFunctions(filePath string) []string {
+	node, err := parser.ParseFile(token.NewFileSet(), filePath, nil, parser.SkipObjectResolution)
+
+	if err != nil {
+		return nil
+	}
+
+	names := []string{}
+
+	for _, decl := range node.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+
+		if !ok || funcDecl.Recv != nil {
+			continue
+		}
+
+		name := funcDecl.Name.Name
+
+		if (isTestFunction(name, "Test") && name != "TestMain") || isTestFunction(name, "Example") || isTestFunction(name, "Fuzz") {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// isTestFunction follows the go test rule, where the prefix can't be followed
+// by a lowercase letter (e.g. Testing isn't a test).
+func isTestFunction(name string, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+
+	if len(name) == len(prefix) {
+		return true
+	}
+
+	next, _ := utf8.DecodeRuneInString(name[len(prefix):])
+
+	return !unicode.IsLower(next)
+}
@@ -4,13 +4,13 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/fatih/camelcase"
+	"golang.org/x/exp/slices"
 )
 
 type StreamConsumer struct {
@@ -21,12 +21,18 @@ type StreamConsumer struct {
 }
 
 type Stream struct {
-	Action  string
-	Elapsed float64
-	Output  string
-	Package string
-	Test    string
-	Time    string
+	Action      string
+	Elapsed     float64
+	Output      string
+	Package     string
+	Test        string
+	Time        string
+	ImportPath  string
+	FailedBuild string
+	OutputType  string
+	Key         string
+	Value       string
+	Path        string
 }
 
 type Test struct {
@@ -39,75 +45,129 @@ type Test struct {
 	StartedAt       time.Time
 	EndedAt         time.Time
 	Elapsed         time.Duration
+	Paused          time.Duration
 	Output          []string
 	Status          string
 	SkipMessage     string
 	Package         string
+	Parent          *Test   `json:"-"`
+	Children        []*Test `json:"-"`
+	Kind            string
+	Got             []string          `json:",omitempty"`
+	Want            []string          `json:",omitempty"`
+	FuzzInput       string            `json:",omitempty"`
+	Panic           *Panic            `json:",omitempty"`
+	Attributes      map[string]string `json:",omitempty"`
+	ArtifactsDir    string            `json:",omitempty"`
+	// Attempts is how many times a flaky test ran until it passed.
+	Attempts int `json:",omitempty"`
+
+	exampleSection string
+	pausedAt       time.Time
+	interrupted    bool
 }
 
-type Benchmark struct {
-	Name                 string
-	Package              string
-	Key                  string `json:"-"`
-	Processors           int
-	Iterations           int
-	DurationPerOperation time.Duration
+// Interrupted tells whether the test didn't finish on its own, because its
+// package stopped (e.g. it panicked or the run was interrupted).
+func (test Test) Interrupted() bool {
+	return test.interrupted
 }
 
-func (consumer StreamConsumer) Ingest(scanner *bufio.Scanner) {
-	consumer.Aggregation.StartedAt = time.Now()
+// Ingest reads all scanners in order, as if they were a single stream, and
+// calls OnFinished once they've been exhausted.
+func (consumer StreamConsumer) Ingest(scanners ...*bufio.Scanner) {
+	startedAt := Clock.Now()
 
-	for scanner.Scan() {
-		var stream Stream
-		line := scanner.Bytes()
-		lineStr := string(line)
+	for _, scanner := range scanners {
+		for scanner.Scan() {
+			var stream Stream
+			line := scanner.Bytes()
+			lineStr := string(line)
 
-		consumer.OnData(lineStr)
+			consumer.OnData(lineStr)
 
-		err := json.Unmarshal(line, &stream)
+			err := json.Unmarshal(line, &stream)
 
-		if err != nil {
-			fmt.Println(lineStr)
-
-			if strings.Contains(lineStr, "[build failed]") {
-				os.Exit(1)
+			if err != nil {
+				if !consumer.processBuildOutput("", lineStr) {
+					consumer.Aggregation.OrphanOutput = append(consumer.Aggregation.OrphanOutput, lineStr)
+				}
+			} else {
+				consumer.process(stream)
 			}
-		} else {
-			consumer.process(stream)
 		}
 	}
 
-	consumer.Aggregation.EndedAt = time.Now()
+	consumer.flushBuildOutput()
+
+	// No event had a timestamp (e.g. everything failed to build), so use the
+	// wall clock instead.
+	if consumer.Aggregation.StartedAt.IsZero() {
+		consumer.Aggregation.StartedAt = startedAt
+		consumer.Aggregation.EndedAt = Clock.Now()
+	}
+
 	consumer.OnFinished(consumer.Aggregation)
 }
 
+// Abort marks the run as stopped for the given reason (e.g. "interrupted").
+// Tests that are still running are finished as failed, as their packages may
+// not have reported anything before stopping.
+func (consumer StreamConsumer) Abort(reason string) {
+	consumer.Aggregation.Aborted = reason
+
+	for _, pkg := range consumer.Aggregation.PackagesMap {
+		if pkg.Status == "" {
+			pkg.Status = "fail"
+			consumer.finishPackageTests(pkg.Name, Clock.Now())
+		}
+	}
+}
+
 func (consumer StreamConsumer) process(stream Stream) {
+	eventTime := consumer.eventTime(stream)
+
 	switch stream.Action {
 	case "start":
 		if stream.Package != "" {
-			_, exists := consumer.Aggregation.CoverageMap[stream.Package]
-
-			if !exists {
-				coverage := Coverage{Package: stream.Package}
-				consumer.Aggregation.CoverageMap[coverage.Package] = &coverage
-			}
+			consumer.resetPackage(stream.Package)
+			consumer.pkg(stream.Package)
+			consumer.coverage(stream.Package)
 		}
 
 	case "run":
 		// A test/benchmark just started running.
 
-		if strings.HasPrefix(stream.Test, "Test") {
+		kind := testKind(stream.Test)
+
+		if kind == "test" || kind == "example" || kind == "fuzz" {
 			test := Test{
 				Name:            stream.Test,
 				Package:         stream.Package,
 				ErrorTraceIndex: -1,
-				ReadableName:    strings.ReplaceAll(strings.Join(camelcase.Split(stream.Test)[1:], " "), " _ ", " "),
+				ReadableName:    readableName(stream.Test),
 				Key:             stream.Package + ":" + stream.Test,
-				StartedAt:       time.Now(),
+				StartedAt:       eventTime,
+				Kind:            kind,
+			}
+
+			parent := consumer.findParent(stream.Package, stream.Test)
+
+			if parent != nil {
+				subtestName := strings.TrimPrefix(stream.Test, parent.Name+"/")
+				test.Parent = parent
+				test.ReadableName = parent.ReadableName + " › " + strings.ReplaceAll(subtestName, "_", " ")
+				parent.Children = append(parent.Children, &test)
+
+				// Seed inputs added with f.Add are named seed#N; anything else
+				// comes from the corpus at testdata/fuzz.
+				if kind == "fuzz" && !strings.HasPrefix(subtestName, "seed#") {
+					test.FuzzInput = "testdata/fuzz/" + parent.Name + "/" + subtestName
+				}
 			}
 
 			consumer.Aggregation.TestsMap[test.Key] = &test
-		} else if strings.HasPrefix(stream.Test, "Benchmark") {
+		} else if kind == "benchmark" {
 			benchmark := Benchmark{
 				Name:    stream.Test,
 				Package: stream.Package,
@@ -117,42 +177,109 @@ func (consumer StreamConsumer) process(stream Stream) {
 			consumer.Aggregation.BenchmarksMap[benchmark.Key] = &benchmark
 		}
 
+	case "pause":
+		// Parallel tests are paused until the sequential ones are done.
+		if test, exists := consumer.Aggregation.TestsMap[stream.Package+":"+stream.Test]; exists {
+			test.pausedAt = eventTime
+		}
+
+	case "cont":
+		if test, exists := consumer.Aggregation.TestsMap[stream.Package+":"+stream.Test]; exists {
+			consumer.resumeTest(test, eventTime)
+		}
+
+	case "attr":
+		// Set by t.Attr.
+		if test, exists := consumer.Aggregation.TestsMap[stream.Package+":"+stream.Test]; exists {
+			if test.Attributes == nil {
+				test.Attributes = map[string]string{}
+			}
+
+			test.Attributes[stream.Key] = stream.Value
+		}
+
+	case "artifacts":
+		// Set by t.ArtifactDir.
+		if test, exists := consumer.Aggregation.TestsMap[stream.Package+":"+stream.Test]; exists {
+			test.ArtifactsDir = stream.Path
+		}
+
+	case "bench":
+		// A benchmark logged something but didn't fail. The output has been
+		// handled already and there's no result to record.
+
+	case "build-output":
+		consumer.processBuildOutput(stream.ImportPath, stream.Output)
+
+	case "build-fail":
+		pkg := strings.Fields(stream.ImportPath)
+		consumer.Aggregation.buildPackage = ""
+
+		if len(pkg) > 0 {
+			consumer.failBuild(pkg[0])
+		}
+
 	case "output":
 		// Something was printed to the console.
 		key := stream.Package + ":" + stream.Test
 
 		if strings.HasPrefix(stream.Test, "Benchmark") {
-			output := strings.TrimSpace(stream.Output)
-			re := regexp.MustCompile(`^(?:.*?-(\d+))\s+(\d+)\s+(.*?)/op$`)
-			matches := re.FindStringSubmatch(output)
+			benchmark, exists := consumer.Aggregation.BenchmarksMap[key]
 
-			if matches != nil {
-				benchmark := consumer.Aggregation.BenchmarksMap[key]
-				procs, _ := strconv.Atoi(matches[1])
-				iters, _ := strconv.Atoi(matches[2])
-				dur, _ := time.ParseDuration(strings.ReplaceAll(matches[3], " ", ""))
-				benchmark.Processors = procs
-				benchmark.Iterations = iters
-				benchmark.DurationPerOperation = dur
+			if exists {
+				benchmark.processOutput(stream.Output)
 			}
 
 			return
 		}
 
+		if stream.Test == "" && buildFailedRegex.MatchString(strings.TrimSpace(stream.Output)) {
+			consumer.failBuild(stream.Package)
+			return
+		}
+
 		if stream.Test == "" {
+			consumer.processPackageOutput(stream)
+
 			re := regexp.MustCompile(`coverage: ([\d.]+)% of statements`)
 			matches := re.FindStringSubmatch(stream.Output)
 
 			if matches != nil {
 				percent, _ := strconv.ParseFloat(matches[1], 64)
-				consumer.Aggregation.CoverageMap[stream.Package].Coverage = percent
+				consumer.pkg(stream.Package).Coverage = percent
+				consumer.coverage(stream.Package).Coverage = percent
+				consumer.coverage(stream.Package).measured = true
 			}
 
 			return
 		}
 
 		output := strings.TrimRight(stream.Output, "\r\n")
-		test := consumer.Aggregation.TestsMap[key]
+		test, exists := consumer.Aggregation.TestsMap[key]
+
+		if !exists {
+			consumer.Aggregation.OrphanOutput = append(consumer.Aggregation.OrphanOutput, output)
+			return
+		}
+
+		if test.Kind == "example" && consumer.processExampleOutput(test, output) {
+			return
+		}
+
+		if test.Kind == "fuzz" {
+			re := regexp.MustCompile(`^\s*Failing input written to (.+)$`)
+			matches := re.FindStringSubmatch(output)
+
+			if matches != nil {
+				test.FuzzInput = matches[1]
+				return
+			}
+		}
+
+		if consumer.processPanicOutput(test, output) {
+			return
+		}
+
 		index := len(test.Output)
 		errorTrace := findErrorTrace(output)
 		shouldAppend := true
@@ -181,23 +308,39 @@ func (consumer StreamConsumer) process(stream Stream) {
 		fallthrough
 	case "pass":
 		// Test/benchmark has finished running.
+		if stream.FailedBuild != "" {
+			consumer.failBuild(stream.Package)
+		}
+
 		if stream.Test == "" {
+			pkg := consumer.pkg(stream.Package)
+			pkg.Status = stream.Action
+			pkg.Elapsed = time.Duration(stream.Elapsed * float64(time.Second))
+			consumer.finishPackageTests(stream.Package, eventTime)
+
 			return
 		}
 
 		key := stream.Package + ":" + stream.Test
-		test := consumer.Aggregation.TestsMap[key]
-		test.EndedAt = time.Now()
-		test.Elapsed = test.EndedAt.Sub(test.StartedAt)
-		test.Status = stream.Action
-		consumer.OnProgress(*test)
+		test, exists := consumer.Aggregation.TestsMap[key]
 
-		if test.Status == "skip" {
+		if !exists {
+			return
+		}
+
+		consumer.finishTest(test, stream.Action, eventTime, stream.Elapsed)
+
+		if test.Status == "skip" && len(test.Output) >= 2 {
 			// let's extract the error trace and message
 			index := len(test.Output) - 2
 			line := test.Output[index]
 			re := regexp.MustCompile(`^(\s*)(.*?\.go:\d+):(?:\s+(.*?))?$`)
 			matches := re.FindStringSubmatch(line)
+
+			if matches == nil {
+				return
+			}
+
 			test.ErrorTrace = matches[2]
 
 			if matches[3] != "" {
@@ -208,8 +351,217 @@ func (consumer StreamConsumer) process(stream Stream) {
 		}
 
 	default:
-		panic("here")
+		consumer.warn("unknown action %q", stream.Action)
+	}
+}
+
+// eventTime returns the event's timestamp, tracking the run's start and end.
+// Events without one (e.g. build output) fall back to the clock.
+func (consumer StreamConsumer) eventTime(stream Stream) time.Time {
+	eventTime, err := time.Parse(time.RFC3339Nano, stream.Time)
+
+	if err != nil {
+		return Clock.Now()
+	}
+
+	aggregation := consumer.Aggregation
+
+	if aggregation.StartedAt.IsZero() || eventTime.Before(aggregation.StartedAt) {
+		aggregation.StartedAt = eventTime
+	}
+
+	if eventTime.After(aggregation.EndedAt) {
+		aggregation.EndedAt = eventTime
+	}
+
+	return eventTime
+}
+
+// finishTest uses the elapsed time reported by go test, which is rounded to
+// hundredths of a second. Anything faster than that is reported as zero, so
+// the timestamps are used instead.
+func (consumer StreamConsumer) finishTest(test *Test, status string, endedAt time.Time, elapsed float64) {
+	consumer.resumeTest(test, endedAt)
+
+	test.EndedAt = endedAt
+	test.Elapsed = time.Duration(elapsed * float64(time.Second))
+	test.Status = status
+
+	// The elapsed time reported by go test doesn't include the time the test
+	// spent paused, so do the same here.
+	if test.Elapsed <= 0 {
+		test.Elapsed = test.EndedAt.Sub(test.StartedAt) - test.Paused
+	}
+
+	if test.Panic != nil {
+		test.Panic.parse()
+	}
+
+	if test.Reportable() {
+		consumer.pkg(test.Package).count(test)
+		consumer.OnProgress(*test)
+	}
+}
+
+// resumeTest accounts for the time spent paused, if any.
+func (consumer StreamConsumer) resumeTest(test *Test, resumedAt time.Time) {
+	if test.pausedAt.IsZero() {
+		return
+	}
+
+	test.Paused += resumedAt.Sub(test.pausedAt)
+	test.pausedAt = time.Time{}
+}
+
+// warn records something unexpected in the stream, like actions added by
+// newer go versions, only once.
+func (consumer StreamConsumer) warn(format string, args ...any) {
+	warning := fmt.Sprintf(format, args...)
+
+	if !slices.Contains(consumer.Aggregation.Warnings, warning) {
+		consumer.Aggregation.Warnings = append(consumer.Aggregation.Warnings, warning)
+	}
+}
+
+// finishPackageTests handles tests that never got a result, which happens
+// when the test binary dies (e.g. a timeout). Tests listed as running in a
+// timeout panic are marked as timed out, and tests running when goroutines
+// were dumped with SIGQUIT are marked as hung.
+func (consumer StreamConsumer) finishPackageTests(pkg string, endedAt time.Time) {
+	tests := []*Test{}
+
+	for _, test := range consumer.Aggregation.Tests() {
+		if test.Package == pkg {
+			tests = append(tests, test)
+		}
+	}
+
+	for _, test := range tests {
+		if test.Panic == nil {
+			continue
+		}
+
+		test.Panic.parse()
+
+		for _, name := range test.Panic.RunningTests {
+			running, exists := consumer.Aggregation.TestsMap[pkg+":"+name]
+
+			if exists && running.Panic == nil {
+				running.Panic = test.Panic
+			}
+		}
+
+		// A goroutine dump doesn't list running tests, but all tests that
+		// haven't finished were hanging as well.
+		if test.Panic.Hung {
+			for _, running := range tests {
+				if running.Status == "" && running.Panic == nil {
+					running.Panic = test.Panic
+				}
+			}
+		}
+	}
+
+	// Subtests are sorted after their parents, so walk backwards to finish
+	// children first.
+	slices.Reverse(tests)
+
+	for _, test := range tests {
+		if test.Status == "" {
+			test.interrupted = true
+			consumer.finishTest(test, "fail", endedAt, 0)
+		}
+	}
+}
+
+func (consumer StreamConsumer) coverage(pkg string) *Coverage {
+	coverage, exists := consumer.Aggregation.CoverageMap[pkg]
+
+	if !exists {
+		coverage = &Coverage{Package: pkg}
+		consumer.Aggregation.CoverageMap[pkg] = coverage
+	}
+
+	return coverage
+}
+
+// Failed examples print the "got:" and "want:" sections after the
+// "--- FAIL" line. Returns true when the line was consumed.
+func (consumer StreamConsumer) processExampleOutput(test *Test, output string) bool {
+	switch {
+	case output == "got:" || output == "want:":
+		test.exampleSection = strings.TrimSuffix(output, ":")
+	case test.exampleSection == "got":
+		test.Got = append(test.Got, output)
+	case test.exampleSection == "want":
+		test.Want = append(test.Want, output)
+	default:
+		return false
 	}
+
+	return true
+}
+
+func (consumer StreamConsumer) findParent(pkg string, name string) *Test {
+	// Subtest names may contain slashes themselves, so walk up until we find
+	// a test that has been registered before.
+	for index := strings.LastIndex(name, "/"); index > 0; index = strings.LastIndex(name, "/") {
+		name = name[:index]
+		parent, exists := consumer.Aggregation.TestsMap[pkg+":"+name]
+
+		if exists {
+			return parent
+		}
+	}
+
+	return nil
+}
+
+// Reportable returns false for parent tests whose result is already
+// represented by their subtests, so they're not counted or listed twice.
+func (test *Test) Reportable() bool {
+	if len(test.Children) == 0 {
+		return true
+	}
+
+	if test.Status != "fail" && test.Status != "flaky" {
+		return false
+	}
+
+	for _, child := range test.Children {
+		if child.Status == test.Status {
+			return false
+		}
+	}
+
+	return true
+}
+
+func testKind(name string) string {
+	switch {
+	case strings.HasPrefix(name, "Test"):
+		return "test"
+	case strings.HasPrefix(name, "Example"):
+		return "example"
+	case strings.HasPrefix(name, "Fuzz"):
+		return "fuzz"
+	case strings.HasPrefix(name, "Benchmark"):
+		return "benchmark"
+	}
+
+	return ""
+}
+
+func readableName(name string) string {
+	words := camelcase.Split(name)
+
+	// Keep the prefix for examples and fuzz targets, so they can be told apart
+	// from regular tests.
+	if testKind(name) == "test" {
+		words = words[1:]
+	}
+
+	return strings.ReplaceAll(strings.Join(words, " "), " _ ", " ")
 }
 
 func findErrorTrace(line string) string {
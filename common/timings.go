@@ -0,0 +1,104 @@
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Timings holds how long each top-level test took the last time it ran, so
+// shards can be balanced by time.
+type Timings struct {
+	Packages map[string]*PackageTimings
+}
+
+type PackageTimings struct {
+	Tests map[string]time.Duration
+}
+
+// TimingsPath returns the default timings file of the project in the working
+// dir.
+func TimingsPath(homeDir string, workingDir string) string {
+	return filepath.Join(CacheDir(homeDir, workingDir), "timings.json")
+}
+
+func LoadTimings(path string) (Timings, error) {
+	timings := Timings{Packages: map[string]*PackageTimings{}}
+	contents, err := os.ReadFile(path)
+
+	if err != nil {
+		return timings, err
+	}
+
+	err = json.Unmarshal(contents, &timings)
+
+	if timings.Packages == nil {
+		timings.Packages = map[string]*PackageTimings{}
+	}
+
+	return timings, err
+}
+
+func (timings Timings) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	contents, _ := json.MarshalIndent(timings, "", "  ")
+
+	return os.WriteFile(path, contents, 0644)
+}
+
+// Update sets the durations of the tests that finished in this run. Other
+// tests are kept, so each shard only updates its own part.
+func (timings Timings) Update(agg *Aggregation) {
+	for _, test := range agg.Tests() {
+		if test.Parent != nil || test.interrupted || (test.Status != "pass" && test.Status != "fail" && test.Status != "flaky") {
+			continue
+		}
+
+		pkg, exists := timings.Packages[test.Package]
+
+		if !exists {
+			pkg = &PackageTimings{Tests: map[string]time.Duration{}}
+			timings.Packages[test.Package] = pkg
+		}
+
+		pkg.Tests[test.Name] = test.Elapsed
+	}
+}
+
+// Test returns the duration of a test, if known.
+func (timings Timings) Test(pkg string, name string) (time.Duration, bool) {
+	packageTimings, exists := timings.Packages[pkg]
+
+	if !exists {
+		return 0, false
+	}
+
+	elapsed, exists := packageTimings.Tests[name]
+
+	return elapsed, exists
+}
+
+// Average returns the average duration of all known tests.
+func (timings Timings) Average() time.Duration {
+	total := time.Duration(0)
+	count := 0
+
+	for _, pkg := range timings.Packages {
+		for _, elapsed := range pkg.Tests {
+			total += elapsed
+			count += 1
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	return total / time.Duration(count)
+}
@@ -9,7 +9,7 @@ import (
 	"golang.org/x/exp/slices"
 )
 
-var availableCommands = []string{"run", "update", "version"}
+var availableCommands = []string{"merge", "run", "update", "version", "watch"}
 
 var usage string = `
 bolt is a golang test runner that has a nicer output.
@@ -20,6 +20,8 @@ bolt is a golang test runner that has a nicer output.
 
     bolt version                  Show bolt version
     bolt run                      Run tests
+    bolt watch                    Run affected tests whenever files change
+    bolt merge                    Merge the results of multiple runs
     bolt update                   Update to the latest released version
     bolt [command] --help         Display help on [command]
 
@@ -55,6 +57,20 @@ func Run(workingDir string, homeDir string, output common.Output) (exitcode int)
 			&output,
 		)
 
+	case "merge":
+		return commands.Merge(
+			args,
+			commands.RunArgs{HomeDir: homeDir, WorkingDir: workingDir},
+			&output,
+		)
+
+	case "watch":
+		return commands.Watch(
+			args,
+			commands.RunArgs{HomeDir: homeDir, WorkingDir: workingDir},
+			&output,
+		)
+
 	default:
 		fmt.Fprint(output.Stdout, usage)
 		return 1
@@ -0,0 +1,119 @@
+//go:build !windows
+
+package commands
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setProcessGroup runs the command in its own process group, so the test
+// binaries started by "go test" can be signaled along with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	unixSignal, ok := sig.(syscall.Signal)
+
+	if !ok {
+		unixSignal = syscall.SIGINT
+	}
+
+	return syscall.Kill(-cmd.Process.Pid, unixSignal)
+}
+
+// quitTestBinaries sends SIGQUIT to the test binaries started by "go test",
+// which makes them dump their goroutines and exit. The go command itself
+// isn't signaled, so it reports the failure and moves on to other packages.
+func quitTestBinaries(cmd *exec.Cmd) error {
+	pids, err := testBinaries("/proc", cmd.Process.Pid)
+
+	if err != nil {
+		return err
+	}
+
+	for _, pid := range pids {
+		syscall.Kill(pid, syscall.SIGQUIT)
+	}
+
+	return nil
+}
+
+// testBinaries returns the test binaries started by the parent process, as
+// listed by procDir. Systems without it, like macOS, use pgrep instead.
+func testBinaries(procDir string, parent int) ([]int, error) {
+	entries, err := os.ReadDir(procDir)
+
+	if os.IsNotExist(err) {
+		return pgrepTestBinaries(parent)
+	} else if err != nil {
+		return nil, err
+	}
+
+	pids := []int{}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+
+		if err != nil {
+			continue
+		}
+
+		// Processes may exit while they're being read.
+		stat, err := os.ReadFile(filepath.Join(procDir, entry.Name(), "stat"))
+
+		if err != nil {
+			continue
+		}
+
+		// The command name is between parens and may have spaces, so the
+		// state and the parent pid are read after the last paren.
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+
+		if len(fields) < 2 || fields[1] != strconv.Itoa(parent) {
+			continue
+		}
+
+		cmdline, err := os.ReadFile(filepath.Join(procDir, entry.Name(), "cmdline"))
+
+		if err != nil {
+			continue
+		}
+
+		name, _, _ := bytes.Cut(cmdline, []byte{0})
+
+		if strings.HasSuffix(string(name), ".test") {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids, nil
+}
+
+func pgrepTestBinaries(parent int) ([]int, error) {
+	out, err := exec.Command("pgrep", "-P", strconv.Itoa(parent), "-f", `\.test( |$)`).Output()
+
+	// pgrep exits with 1 when no processes match, like when packages are
+	// still being built.
+	if exiterr, ok := err.(*exec.ExitError); ok && exiterr.ExitCode() == 1 {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	pids := []int{}
+
+	for _, pid := range strings.Fields(string(out)) {
+		if id, err := strconv.Atoi(pid); err == nil {
+			pids = append(pids, id)
+		}
+	}
+
+	return pids, nil
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestBinaries(t *testing.T) {
+	process := func(t *testing.T, procDir string, pid string, stat string, cmdline string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(procDir, pid), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(procDir, pid, "stat"), []byte(stat), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(procDir, pid, "cmdline"), []byte(cmdline), 0644))
+	}
+
+	t.Run("FindsTestBinaries", func(t *testing.T) {
+		procDir := t.TempDir()
+		process(t, procDir, "10", "10 (pkg.test) S 5 10 5 0", "/tmp/go-build/b001/pkg.test\x00-test.v=test2json\x00")
+		process(t, procDir, "11", "11 (a (weird) name) S 5 11 5 0", "/tmp/go-build/b002/other.test\x00")
+		process(t, procDir, "12", "12 (vet) S 5 12 5 0", "/usr/lib/go/pkg/tool/vet\x00pkg.test\x00")
+		process(t, procDir, "13", "13 (pkg.test) S 6 13 6 0", "/tmp/go-build/b003/pkg.test\x00")
+		require.NoError(t, os.MkdirAll(filepath.Join(procDir, "self"), 0755))
+		require.NoError(t, os.MkdirAll(filepath.Join(procDir, "14"), 0755))
+
+		pids, err := testBinaries(procDir, 5)
+
+		require.NoError(t, err)
+		require.ElementsMatch(t, []int{10, 11}, pids)
+	})
+
+	t.Run("FailsWithoutProcOrPgrep", func(t *testing.T) {
+		t.Setenv("PATH", t.TempDir())
+
+		_, err := testBinaries(filepath.Join(t.TempDir(), "proc"), os.Getpid())
+
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "pgrep")
+	})
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package commands
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// signalProcessGroup kills the command, as Windows can't send signals to other
+// processes.
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Kill()
+}
+
+// quitTestBinaries kills the command, as goroutines can't be dumped on
+// Windows.
+func quitTestBinaries(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
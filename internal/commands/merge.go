@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"strings"
+
+	c "github.com/fnando/bolt/common"
+)
+
+var mergeUsage string = `
+Merge the results of multiple runs (e.g. parallel CI jobs) into one report.
+
+Files can be streams saved with --record or "go test -json", or the output of
+the JSON reporter, and may be gzipped. When a package is present in more than
+one file, only its last run is reported.
+
+  Usage: bolt merge [options] files...
+
+  Options:
+    Any option from "bolt run" that changes how the report is displayed or
+    checked can be used (see "bolt run --help"), like --reporter,
+    --post-run-command, --min-coverage and --coverage-format. Coverage
+    profiles from each run can be passed as comma-separated files:
+
+    $ bolt merge --coverprofile=1.out,2.out shard-1.log shard-2.log
+`
+
+func Merge(args []string, options RunArgs, output *c.Output) int {
+	flags := newRunFlags(&options)
+	flags.SetOutput(bufio.NewWriter(&bytes.Buffer{}))
+	err := flags.Parse(args)
+
+	if err == flag.ErrHelp {
+		fmt.Fprint(output.Stdout, mergeUsage)
+		return 0
+	} else if err != nil {
+		fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+		return 1
+	}
+
+	files := []string{}
+
+	for _, arg := range flags.Args() {
+		if arg != "--" {
+			files = append(files, arg)
+		}
+	}
+
+	if len(files) == 0 {
+		fmt.Fprintf(output.Stderr, "%s %s\n", c.Color.Fail("ERROR:"), "No files to merge")
+		return 1
+	}
+
+	runArgs := []string{}
+
+	flags.Visit(func(flag *flag.Flag) {
+		if flag.Name != "replay" {
+			runArgs = append(runArgs, "--"+flag.Name+"="+flag.Value.String())
+		}
+	})
+
+	runArgs = append(runArgs, "--replay="+strings.Join(files, ","))
+
+	return Run(runArgs, options, output)
+}
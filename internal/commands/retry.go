@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"regexp"
+	"strings"
+
+	c "github.com/fnando/bolt/common"
+)
+
+// retryFailedTests runs each failed top-level test again in its own package,
+// up to the number of retries. Tests that pass on a later attempt are marked
+// as flaky.
+func retryFailedTests(consumer *c.StreamConsumer, output *c.Output, options RunArgs, goTestArgs []string, env []string) {
+	aggregation := consumer.Aggregation
+
+	for _, test := range aggregation.Tests() {
+		if test.Parent != nil || test.Status != "fail" {
+			continue
+		}
+
+		for attempt := 2; attempt <= options.Retries+1; attempt++ {
+			if !retryTest(test, output, options, goTestArgs, env) {
+				continue
+			}
+
+			aggregation.MarkFlaky(test, attempt)
+
+			for _, flaky := range flattenTest(test) {
+				if flaky.Status == "flaky" && flaky.Reportable() {
+					consumer.OnProgress(*flaky)
+				}
+			}
+
+			break
+		}
+	}
+}
+
+func retryTest(test *c.Test, output *c.Output, options RunArgs, goTestArgs []string, env []string) bool {
+	consumer := c.StreamConsumer{
+		Aggregation: &c.Aggregation{
+			TestsMap:         map[string]*c.Test{},
+			CoverageMap:      map[string]*c.Coverage{},
+			BenchmarksMap:    map[string]*c.Benchmark{},
+			BuildFailuresMap: map[string]*c.BuildFailure{},
+			PackagesMap:      map[string]*c.Package{},
+		},
+		OnData:     func(line string) {},
+		OnProgress: func(test c.Test) {},
+		OnFinished: func(aggregation *c.Aggregation) {},
+	}
+
+	args := []string{"-json"}
+
+	if !options.Compat {
+		args = append(args, "-fullpath")
+	}
+
+	args = append(args, withoutCoverProfile(goTestArgs)...)
+	args = append(args, "-count=1", "-run", "^"+regexp.QuoteMeta(test.Name)+"$", test.Package)
+
+	_, err := Exec(&consumer, output, args, env)
+
+	if err != nil {
+		return false
+	}
+
+	retried, exists := consumer.Aggregation.TestsMap[test.Key]
+
+	return exists && retried.Status == "pass"
+}
+
+func flattenTest(test *c.Test) []*c.Test {
+	tests := []*c.Test{test}
+
+	for _, child := range test.Children {
+		tests = append(tests, flattenTest(child)...)
+	}
+
+	return tests
+}
+
+// withoutCoverProfile removes -coverprofile, so retries don't overwrite the
+// profile of the main run.
+func withoutCoverProfile(args []string) []string {
+	result := []string{}
+
+	for index := 0; index < len(args); index++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[index], "-"), "=")
+
+		if name != "coverprofile" && name != "test.coverprofile" {
+			result = append(result, args[index])
+			continue
+		}
+
+		if !hasValue {
+			index += 1
+		}
+	}
+
+	return result
+}
@@ -3,36 +3,75 @@ package commands
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	c "github.com/fnando/bolt/common"
 	"github.com/fnando/bolt/internal/reporters"
 	"github.com/joho/godotenv"
+	"golang.org/x/exp/slices"
 )
 
 type RunArgs struct {
-	Compat            bool
-	CoverageCount     int
-	CoverageThreshold float64
-	Debug             bool
-	Dotenv            string
-	HideCoverage      bool
-	HideSlowest       bool
-	HomeDir           string
-	NoColor           bool
-	Raw               bool
-	Replay            string
-	Reporter          string
-	SlowestCount      int
-	SlowestThreshold  string
-	WorkingDir        string
-	PostRunCommand    string
+	Compat             bool
+	CoverDir           string
+	CoverProfile       string
+	CoverageCount      int
+	CoverageDiff       string
+	CoverageFormat     string
+	CoverageThreshold  float64
+	Debug              bool
+	Dotenv             string
+	Failed             bool
+	FailFast           bool
+	FailedThenAll      bool
+	FullTrace          bool
+	HangTimeout        string
+	Instafail          bool
+	HideCoverage       bool
+	HidePackages       bool
+	HideSlowest        bool
+	HomeDir            string
+	MinCoverage        float64
+	MinDiffCoverage    float64
+	MinPackageCoverage string
+	MinTotalCoverage   float64
+	NoColor            bool
+	OnFinished         func(aggregation *c.Aggregation)
+	Raw                bool
+	Record             string
+	Replay             string
+	Reporter           string
+	Retries            int
+	Shard              string
+	ShardTests         bool
+	SlowestCount       int
+	SlowestThreshold   string
+	Timings            string
+	WorkingDir         string
+	PostRunCommand     string
+
+	// runs are tests that need their own "go test" call, like the failed
+	// tests of --failed.
+	runs []testRun
+}
+
+// testRun selects tests of some packages with -run, which must not be applied
+// to the other packages.
+type testRun struct {
+	Packages []string
+	Pattern  string
 }
 
 var usage string = `
@@ -45,8 +84,8 @@ Run tests by wrapping "go tests".
 
   Available reporters:
     progress
-      Print a character for each test, with a test summary and list of
-      failed/skipped tests.
+      Print a character for each test, with a test summary, list of
+      failed/skipped tests and a summary of each package.
 
     json
       Print a JSON representation of the bolt state.
@@ -75,6 +114,99 @@ Run tests by wrapping "go tests".
     Note: -fullpath was introduced on go 1.21. If you're using an older
     version, you can use --compat or manually set arguments by using --raw.
 
+    bolt also appends -coverprofile, so it can show the least covered files
+    and functions of each package. The profile is saved to a temporary file,
+    unless you set one with --coverprofile.
+
+
+  Recording:
+    To save the "go test" output to a file, use --record. The file includes
+    a header with the bolt and go versions, and the arguments that were used,
+    so it can be attached to bug reports or replayed later:
+
+    $ bolt ./... --record=bolt.log
+    $ bolt --replay=bolt.log
+
+    --replay also accepts gzipped files, multiple comma-separated files
+    (e.g. one per CI shard), and "-" to read from stdin. When a package is
+    present in more than one file, only its last run is reported:
+
+    $ bolt --replay=shard-1.log.gz,shard-2.log.gz
+    $ go test -json ./... | bolt --replay=-
+
+
+  Retries:
+    Use --retries to run failed tests again. Each failed test runs in its
+    own package with -run '^TestName$' -count=1, up to the number of
+    retries. Tests that pass on a later attempt are reported as flaky, and
+    the run only fails when a test fails every attempt:
+
+    $ bolt ./... --retries=2
+
+
+  Fail fast:
+    Use --fail-fast to stop "go test" as soon as a test fails. The report
+    only has the tests that ran, and lists how many packages never ran:
+
+    $ bolt ./... --fail-fast
+
+
+  Sharding:
+    To split the tests across CI jobs, use --shard with the job index and
+    the number of jobs. Packages are balanced by the duration of their tests
+    in previous runs, or by the number of tests when there are no timings.
+    Use --shard-tests to also split the tests of packages bigger than a
+    shard (it can't be combined with -run, which is how the tests of split
+    packages are selected):
+
+    $ bolt ./... --shard=2/5 --timings=bolt-timings.json
+
+    Timings are saved after each run, to ~/.bolt/cache by default. Every job
+    must use the same timings file, so they compute the same split.
+
+
+  Running failed tests:
+    The failures of the last run are saved to ~/.bolt/cache. Use --failed to
+    run only the tests that failed, subtests included. With
+    --failed-then-all, all tests run once the failed ones pass:
+
+    $ bolt ./...
+    $ bolt --failed --failed-then-all ./...
+
+
+  Coverage gate:
+    The run fails when the coverage is below the minimums set with
+    --min-coverage (any package), --min-package-coverage (specific packages)
+    or --min-total-coverage (all packages combined). Package patterns can end
+    with "/..." to include subpackages, and take precedence over
+    --min-coverage:
+
+    $ bolt ./... --min-coverage=70 --min-package-coverage=example.com/app/internal/...=90
+
+    To check the coverage of what changed, use --coverage-diff with a git
+    ref. The lines changed since the ref (including uncommitted changes and
+    untracked files) are crossed with the coverage profile. Use
+    --min-diff-coverage to fail when the coverage of changed lines is below a
+    percentage:
+
+    $ bolt ./... --coverage-diff=origin/main --min-diff-coverage=80
+
+    Binaries built with "go build -cover" and executed by your tests can
+    contribute to the coverage, too. bolt sets BOLT_COVERDIR to a directory
+    where these binaries must write their counters. Because go test
+    overrides GOCOVERDIR, set it when executing them:
+
+    cmd := exec.Command(bin)
+    cmd.Env = append(os.Environ(), "GOCOVERDIR="+os.Getenv("BOLT_COVERDIR"))
+
+    The counters are merged with the unit tests coverage. Use --coverdir to
+    keep them in a specific directory.
+
+    The coverage can also be exported as Cobertura XML or LCOV, which is
+    what many code review tools and editors read:
+
+    $ bolt ./... --coverage-format=cobertura:coverage.xml,lcov:coverage.info
+
 
   Env files:
     bolt will load .env.test by default. You can also set it to a
@@ -92,6 +224,7 @@ Run tests by wrapping "go tests".
     export BOLT_PASS_COLOR="32"
     export BOLT_SKIP_COLOR="33"
     export BOLT_DETAIL_COLOR="34"
+    export BOLT_FLAKY_COLOR="35"
 
     To disable colored output you can use "--no-color" or
     set the env var NO_COLOR=1.
@@ -104,6 +237,7 @@ Run tests by wrapping "go tests".
     export BOLT_FAIL_SYMBOL=❌
     export BOLT_PASS_SYMBOL=⚡️
     export BOLT_SKIP_SYMBOL=😴
+    export BOLT_FLAKY_SYMBOL=🎲
 
 
   Post run command:
@@ -115,6 +249,8 @@ Run tests by wrapping "go tests".
       a text summarizing the tests
     BOLT_TITLE
       a text that can be used as the title (e.g. Passed!)
+    BOLT_STATUS
+      the status of the run (pass, skip, fail or interrupted)
     BOLT_TEST_COUNT
       a number representing the total number of tests
     BOLT_FAIL_COUNT
@@ -123,8 +259,20 @@ Run tests by wrapping "go tests".
       a number representing the total number of passing tests
     BOLT_SKIP_COUNT
       a number representing the total number of skipped tests
+    BOLT_FLAKY_COUNT
+      a number representing the total number of flaky tests
     BOLT_BENCHMARK_COUNT
       a number representing the total number of benchmarks
+    BOLT_EXAMPLE_COUNT
+      a number representing the total number of examples
+    BOLT_FUZZ_COUNT
+      a number representing the total number of fuzz targets
+    BOLT_BUILD_FAILURE_COUNT
+      a number representing the total number of packages that failed to build
+    BOLT_COVERAGE_GATE_FAILURE_COUNT
+      a number representing the total number of coverage minimums not met
+    BOLT_COVERAGE_GATE_FAILURES
+      a text listing the coverage minimums not met, one per line
     BOLT_ELAPSED
       a string representing the duration (e.g. 1m20s)
     BOLT_ELAPSED_NANOSECONDS
@@ -132,7 +280,7 @@ Run tests by wrapping "go tests".
 
 `
 
-func Run(args []string, options RunArgs, output *c.Output) int {
+func newRunFlags(options *RunArgs) *flag.FlagSet {
 	flags := flag.NewFlagSet("bolt", flag.ContinueOnError)
 	flags.Usage = func() {}
 
@@ -145,19 +293,44 @@ func Run(args []string, options RunArgs, output *c.Output) int {
 
 	flags.BoolVar(&options.Raw, "raw", false, "Don't append arguments to `go test`")
 	flags.BoolVar(&options.Compat, "compat", false, "Don't append -fullpath, available on go 1.21 or new")
+	flags.BoolVar(&options.FullTrace, "full-trace", false, "Display the full goroutine dump when a test panics or times out")
 	flags.BoolVar(&options.HideCoverage, "hide-coverage", false, "Don't display the coverage section")
 	flags.BoolVar(&options.HideSlowest, "hide-slowest", false, "Don't display the slowest tests section")
+	flags.BoolVar(&options.HidePackages, "hide-packages", false, "Don't display the packages section")
 	flags.StringVar(&options.Dotenv, "env", ".env.test", "Load env file")
+	flags.BoolVar(&options.Failed, "failed", false, "Run only the tests that failed in the last run")
+	flags.BoolVar(&options.FailedThenAll, "failed-then-all", false, "When using --failed, run all tests once the failed ones pass")
+	flags.BoolVar(&options.FailFast, "fail-fast", false, "Stop running tests after the first failure")
+	flags.BoolVar(&options.Instafail, "instafail", false, "Print failures as soon as they happen, besides the final report (progress and standard reporters)")
+	flags.StringVar(&options.HangTimeout, "hang-timeout", "", "Dump the goroutines of tests that don't output anything for this long (e.g. 2m) and fail them as hung")
+	flags.StringVar(&options.CoverDir, "coverdir", "", "Directory for coverage counters written by binaries built with -cover. When replaying, read the counters from it")
+	flags.StringVar(&options.CoverProfile, "coverprofile", "", "Save the coverage profile to a file. When replaying, read the profile from it")
+	flags.StringVar(&options.CoverageDiff, "coverage-diff", "", "Show the coverage of lines changed since a git ref (e.g. origin/main)")
+	flags.StringVar(&options.CoverageFormat, "coverage-format", "", "Export the coverage as format:path, comma-separated (formats: cobertura, lcov)")
 	flags.IntVar(&options.CoverageCount, "coverage-count", 10, "Number of coverate items to show")
 	flags.Float64Var(&options.CoverageThreshold, "coverage-threshold", 100.0, "Anything below this threshold will be listed")
+	flags.Float64Var(&options.MinCoverage, "min-coverage", 0, "Fail when a package's coverage is below this percentage")
+	flags.Float64Var(&options.MinDiffCoverage, "min-diff-coverage", 0, "Fail when the coverage of lines changed since --coverage-diff is below this percentage")
+	flags.StringVar(&options.MinPackageCoverage, "min-package-coverage", "", "Comma-separated minimums for specific packages (e.g. example.com/app/internal/...=80)")
+	flags.Float64Var(&options.MinTotalCoverage, "min-total-coverage", 0, "Fail when the total coverage is below this percentage")
 	flags.StringVar(&options.SlowestThreshold, "slowest-threshold", "1s", "Anything above this threshold will be listed. Must be a valid duration string")
 	flags.IntVar(&options.SlowestCount, "slowest-count", 10, "Number of slowest tests to show")
 	flags.StringVar(&options.PostRunCommand, "post-run-command", "", "Run a command after runner is done")
+	flags.StringVar(&options.Replay, "replay", "", "Report from \"go test -json\" files instead of running tests (comma-separated, - for stdin)")
+	flags.StringVar(&options.Record, "record", "", "Save the \"go test\" output to a file that can be replayed")
+	flags.StringVar(&options.Shard, "shard", "", "Run a part of the tests, as index/total (e.g. 2/5), balanced by the timings of previous runs")
+	flags.BoolVar(&options.ShardTests, "shard-tests", false, "When using --shard, also split the tests of packages bigger than a shard")
+	flags.StringVar(&options.Timings, "timings", "", "File with the test timings used by --shard, which is updated after each run. Defaults to a file in ~/.bolt/cache")
+	flags.IntVar(&options.Retries, "retries", 0, "Run failed tests again up to this number of times. Tests that pass are reported as flaky")
 
 	flags.BoolVar(&options.Debug, "debug", false, "")
-	flags.StringVar(&options.Replay, "replay", "", "")
 	flags.StringVar(&options.Reporter, "reporter", "progress", "")
 
+	return flags
+}
+
+func Run(args []string, options RunArgs, output *c.Output) int {
+	flags := newRunFlags(&options)
 	flags.SetOutput(bufio.NewWriter(&bytes.Buffer{}))
 	err := flags.Parse(args)
 
@@ -197,6 +370,67 @@ func Run(args []string, options RunArgs, output *c.Output) int {
 		return 1
 	}
 
+	if options.Failed {
+		return runFailed(args, flags.Args(), options, output)
+	}
+
+	return runTests(args, flags.Args(), options, output)
+}
+
+// runFailed runs the tests that failed in the last run. With
+// --failed-then-all, all tests run once they pass.
+func runFailed(args []string, testArgs []string, options RunArgs, output *c.Output) int {
+	lastRun, err := c.LoadLastRun(c.LastRunPath(options.HomeDir, options.WorkingDir))
+
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+		return 1
+	}
+
+	if len(lastRun.Failures) > 0 {
+		_, goTestArgs := splitPackages(testArgs)
+		failedOptions := options
+		packages, runs := failedRuns(lastRun)
+		failedOptions.runs = runs
+		exitcode := runTests(args, append(packages, goTestArgs...), failedOptions, output)
+
+		if exitcode != 0 || !options.FailedThenAll {
+			return exitcode
+		}
+
+		fmt.Fprintf(output.Stdout, "\n%s\n", c.Color.Detail("The failed tests are passing now. Running all tests."))
+	} else if !options.FailedThenAll {
+		fmt.Fprintln(output.Stdout, "No failed tests from the last run.")
+		return 0
+	}
+
+	return runTests(args, testArgs, options, output)
+}
+
+// failedRuns splits the failures of the last run into packages that run all
+// of their tests and the run of the failed tests. Packages that failed without
+// failing tests (e.g. build failures) can't get the -run of other packages, or
+// none of their tests would run.
+func failedRuns(lastRun c.LastRun) ([]string, []testRun) {
+	packages := []string{}
+	testedPackages := []string{}
+
+	for _, failure := range lastRun.Failures {
+		if len(failure.Tests) == 0 {
+			packages = append(packages, failure.Package)
+		} else {
+			testedPackages = append(testedPackages, failure.Package)
+		}
+	}
+
+	if len(testedPackages) == 0 {
+		return packages, nil
+	}
+
+	return packages, []testRun{{Packages: testedPackages, Pattern: lastRun.RunPattern()}}
+}
+
+func runTests(args []string, testArgs []string, options RunArgs, output *c.Output) int {
 	slowestThreshold, err := time.ParseDuration(options.SlowestThreshold)
 
 	if err != nil {
@@ -204,27 +438,280 @@ func Run(args []string, options RunArgs, output *c.Output) int {
 		return 1
 	}
 
+	hangTimeout := time.Duration(0)
+
+	if options.HangTimeout != "" {
+		hangTimeout, err = time.ParseDuration(options.HangTimeout)
+
+		if err != nil {
+			fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+			return 1
+		}
+	}
+
+	packageMinimums, err := c.ParsePackageMinimums(options.MinPackageCoverage)
+
+	if err != nil {
+		fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+		return 1
+	}
+
+	timingsPath := options.Timings
+
+	if timingsPath == "" && options.HomeDir != "" {
+		timingsPath = c.TimingsPath(options.HomeDir, options.WorkingDir)
+	}
+
+	// A shard may only have split packages (or nothing at all), in which case
+	// running "go test" without packages would test the current dir. The same
+	// goes for --failed, when only packages with failed tests are run.
+	hasPackages := true
+
+	if options.Shard != "" && options.Replay == "" && !options.Raw {
+		shard, err := c.ParseShard(options.Shard)
+
+		if err != nil {
+			fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+			return 1
+		}
+
+		timings, err := c.LoadTimings(timingsPath)
+
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+			return 1
+		}
+
+		patterns, goTestArgs := splitPackages(testArgs)
+
+		// Split packages run with their own -run, which would override the
+		// one given to go test.
+		if options.ShardTests && findFlag(goTestArgs, "run") != "" {
+			fmt.Fprintf(output.Stderr, "%s --shard-tests can't be used with -run\n", c.Color.Fail("ERROR:"))
+			return 1
+		}
+
+		if len(patterns) == 0 {
+			patterns = []string{"."}
+		}
+
+		shardPlan, err := shard.Plan(patterns, buildArgs(goTestArgs), timings, options.ShardTests)
+
+		if err != nil {
+			fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+			return 1
+		}
+
+		// Only whole packages are kept, as packages that have been split need
+		// their own -run.
+		packages := []string{}
+
+		for _, shardPackage := range shardPlan {
+			if len(shardPackage.Tests) == 0 {
+				packages = append(packages, shardPackage.Package)
+				continue
+			}
+
+			tests := []string{}
+
+			for _, test := range shardPackage.Tests {
+				tests = append(tests, regexp.QuoteMeta(test))
+			}
+
+			options.runs = append(options.runs, testRun{
+				Packages: []string{shardPackage.Package},
+				Pattern:  "^(" + strings.Join(tests, "|") + ")$",
+			})
+		}
+
+		testArgs = append(packages, goTestArgs...)
+		hasPackages = len(packages) > 0
+	} else if patterns, _ := splitPackages(testArgs); len(options.runs) > 0 && len(patterns) == 0 {
+		hasPackages = false
+	}
+
 	exitcode := 1
 	consumer := c.StreamConsumer{
 		Aggregation: &c.Aggregation{
 			TestsMap:          map[string]*c.Test{},
 			CoverageMap:       map[string]*c.Coverage{},
 			BenchmarksMap:     map[string]*c.Benchmark{},
+			BuildFailuresMap:  map[string]*c.BuildFailure{},
+			PackagesMap:       map[string]*c.Package{},
 			CoverageThreshold: options.CoverageThreshold,
 			CoverageCount:     options.CoverageCount,
-			SlowestThreshold:  slowestThreshold,
-			SlowestCount:      options.SlowestCount,
+			CoverageGate: c.CoverageGate{
+				Minimum:         options.MinCoverage,
+				PackageMinimums: packageMinimums,
+				TotalMinimum:    options.MinTotalCoverage,
+				DiffMinimum:     options.MinDiffCoverage,
+			},
+			SlowestThreshold: slowestThreshold,
+			SlowestCount:     options.SlowestCount,
 		},
 	}
 
+	execArgs := []string{"-json", "-cover"}
+
+	if !options.Compat {
+		execArgs = append(execArgs, "-fullpath")
+	}
+
+	extraArgs := []string{}
+
+	for _, arg := range testArgs {
+		if arg != "--" {
+			extraArgs = append(extraArgs, arg)
+		}
+	}
+
+	// The coverage profile is used to show per-file and per-function
+	// coverage. When replaying, it must be provided with --coverprofile.
+	coverProfile := findCoverProfile(extraArgs)
+
+	if coverProfile == "" && options.Replay == "" && !options.Raw {
+		coverProfile = options.CoverProfile
+
+		if coverProfile == "" {
+			file, err := os.CreateTemp("", "bolt-*.coverprofile")
+
+			if err != nil {
+				fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+				return 1
+			}
+
+			file.Close()
+			defer os.Remove(file.Name())
+			coverProfile = file.Name()
+		}
+
+		execArgs = append(execArgs, "-coverprofile="+coverProfile)
+	} else if options.Replay != "" {
+		coverProfile = options.CoverProfile
+
+		// Profiles from multiple runs (e.g. CI jobs) are combined.
+		if strings.Contains(coverProfile, ",") {
+			file, err := os.CreateTemp("", "bolt-*.coverprofile")
+
+			if err != nil {
+				fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+				return 1
+			}
+
+			file.Close()
+			defer os.Remove(file.Name())
+			coverProfile = file.Name()
+
+			for _, profilePath := range strings.Split(options.CoverProfile, ",") {
+				if err := c.AppendCoverProfile(coverProfile, profilePath); err != nil {
+					fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+					return 1
+				}
+			}
+		}
+	}
+
+	// Binaries built with "go build -cover" and executed by tests can write
+	// their coverage counters to BOLT_COVERDIR. go test overrides GOCOVERDIR,
+	// so tests must set it when executing these binaries.
+	coverDir := options.CoverDir
+
+	if coverDir == "" && options.Replay == "" {
+		dir, err := os.MkdirTemp("", "bolt-coverdir-*")
+
+		if err != nil {
+			fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+			return 1
+		}
+
+		defer os.RemoveAll(dir)
+		coverDir = dir
+	}
+
+	// Packages split across shards (or the failed tests of --failed) run
+	// separately, each one writing its own coverage profile that's merged
+	// later.
+	argsList := [][]string{}
+	shardProfiles := []string{}
+
+	for _, run := range options.runs {
+		shardArgs := []string{}
+
+		for _, arg := range execArgs {
+			if !strings.HasPrefix(arg, "-coverprofile=") {
+				shardArgs = append(shardArgs, arg)
+			}
+		}
+
+		_, goTestArgs := splitPackages(testArgs)
+		shardArgs = append(shardArgs, goTestArgs...)
+
+		if coverProfile != "" {
+			shardProfile := fmt.Sprintf("%s.%d", coverProfile, len(shardProfiles))
+			shardProfiles = append(shardProfiles, shardProfile)
+			shardArgs = append(shardArgs, "-coverprofile="+shardProfile)
+			defer os.Remove(shardProfile)
+		}
+
+		shardArgs = append(shardArgs, "-run", run.Pattern)
+		shardArgs = append(shardArgs, run.Packages...)
+		argsList = append(argsList, shardArgs)
+	}
+
+	execArgs = append(execArgs, extraArgs...)
+
+	if options.Raw {
+		execArgs = testArgs
+	}
+
+	if hasPackages {
+		argsList = append([][]string{execArgs}, argsList...)
+	}
+
 	reporterList := []reporters.Reporter{
 		reporters.PostRunCommandReporter{Output: output, Command: options.PostRunCommand},
 	}
 
+	if options.Record != "" {
+		file, err := os.Create(options.Record)
+
+		if err != nil {
+			fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+			return 1
+		}
+
+		defer file.Close()
+
+		goTestArgs := []string{}
+
+		if options.Replay == "" {
+			goTestArgs = append([]string{"test"}, execArgs...)
+		}
+
+		fmt.Fprintln(file, c.NewRecordHeader(args, goTestArgs))
+		reporterList = append(reporterList, reporters.RecordReporter{Writer: file})
+	}
+
+	var instafail *reporters.Instafail
+
+	if options.Instafail {
+		instafail = &reporters.Instafail{FullTrace: options.FullTrace, Aggregation: consumer.Aggregation}
+	}
+
 	if options.Reporter == "progress" {
-		reporterList = append(reporterList, reporters.ProgressReporter{Output: output})
+		progressReporter := reporters.ProgressReporter{Output: output, FullTrace: options.FullTrace, Instafail: instafail}
+
+		// The status line needs to know which packages are going to run, so
+		// it's only shown when it can be redrawn.
+		if options.Replay == "" && !options.Raw && reporters.IsTerminal(output.Stdout) {
+			packages, _ := plannedPackages(testArgs, hasPackages, options.runs)
+			timings, _ := c.LoadTimings(timingsPath)
+			progressReporter.StatusLine = reporters.NewStatusLine(output, packages, timings)
+		}
+
+		reporterList = append(reporterList, progressReporter)
 	} else if options.Reporter == "standard" {
-		reporterList = append(reporterList, reporters.StandardReporter{Output: output})
+		reporterList = append(reporterList, reporters.StandardReporter{Output: output, Instafail: instafail})
 	} else if options.Reporter == "json" {
 		reporterList = append(reporterList, reporters.JSONReporter{Output: output})
 	} else {
@@ -232,63 +719,161 @@ func Run(args []string, options RunArgs, output *c.Output) int {
 		return 1
 	}
 
+	// Coverage files go first, so they're available to the post run command.
+	coverageReporters := []reporters.Reporter{}
+
+	for _, entry := range strings.Split(options.CoverageFormat, ",") {
+		if entry == "" {
+			continue
+		}
+
+		format, formatPath, _ := strings.Cut(entry, ":")
+
+		if formatPath == "" {
+			fmt.Fprintf(output.Stderr, "%s %s\n", c.Color.Fail("ERROR:"), "Coverage format must be set as format:path (e.g. lcov:coverage.info)")
+			return 1
+		}
+
+		if format == "cobertura" {
+			coverageReporters = append(coverageReporters, reporters.CoberturaReporter{Output: output, Path: formatPath, WorkingDir: options.WorkingDir})
+		} else if format == "lcov" {
+			coverageReporters = append(coverageReporters, reporters.LCOVReporter{Output: output, Path: formatPath, WorkingDir: options.WorkingDir})
+		} else {
+			fmt.Fprintf(output.Stderr, "%s %s\n", c.Color.Fail("ERROR:"), "Invalid coverage format ("+format+")")
+			return 1
+		}
+	}
+
+	reporterList = append(coverageReporters, reporterList...)
+
 	consumer.OnData = func(line string) {
 		for _, reporter := range reporterList {
 			reporter.OnData(line)
 		}
 	}
 
+	stop := make(chan os.Signal, 1)
+
 	consumer.OnProgress = func(test c.Test) {
 		for _, reporter := range reporterList {
 			reporter.OnProgress(test)
 		}
+
+		if options.FailFast && options.Replay == "" && test.Status == "fail" && consumer.Aggregation.Aborted == "" {
+			consumer.Aggregation.Aborted = "fail-fast"
+			stop <- os.Interrupt
+		}
 	}
 
+	env := []string{"BOLT_COVERDIR=" + coverDir}
+
 	consumer.OnFinished = func(aggregation *c.Aggregation) {
-		reporterOptions := reporters.ReporterFinishedOptions{
-			Aggregation:  aggregation,
-			HideCoverage: options.HideCoverage,
-			HideSlowest:  options.HideSlowest,
-			Debug:        options.Debug,
+		if aggregation.Aborted != "" {
+			notRunPackages, err := findNotRunPackages(aggregation, testArgs, hasPackages, options.runs)
+
+			if err != nil {
+				aggregation.Warnings = append(aggregation.Warnings, err.Error())
+			}
+
+			aggregation.NotRunPackages = notRunPackages
 		}
 
-		for _, reporter := range reporterList {
-			reporter.OnFinished(reporterOptions)
+		if options.Retries > 0 && options.Replay == "" && !options.Raw && aggregation.Aborted == "" {
+			_, goTestArgs := splitPackages(testArgs)
+			retryFailedTests(&consumer, output, options, goTestArgs, env)
 		}
-	}
 
-	if options.Replay == "" {
-		execArgs := append([]string{"-json", "-cover"})
+		if coverProfile != "" {
+			additionalProfiles := []string{}
+
+			if coverDir != "" {
+				integrationProfile := filepath.Join(os.TempDir(), fmt.Sprintf("bolt-%d.coverdir.coverprofile", os.Getpid()))
+				converted, err := c.CoverDirProfile(coverDir, integrationProfile)
+
+				if err != nil {
+					aggregation.Warnings = append(aggregation.Warnings, "can't read coverage counters from "+coverDir+": "+err.Error())
+				}
+
+				if converted {
+					defer os.Remove(integrationProfile)
+					additionalProfiles = append(additionalProfiles, integrationProfile)
+				}
+			}
+
+			for _, shardProfile := range shardProfiles {
+				if err := c.AppendCoverProfile(coverProfile, shardProfile); err != nil && !os.IsNotExist(err) {
+					aggregation.Warnings = append(aggregation.Warnings, "can't merge coverage profile: "+err.Error())
+				}
+			}
+
+			err := aggregation.LoadCoverProfile(coverProfile, additionalProfiles...)
+
+			if err != nil && !os.IsNotExist(err) {
+				aggregation.Warnings = append(aggregation.Warnings, "can't read coverage profile: "+err.Error())
+			}
+		}
 
-		if !options.Compat {
-			execArgs = append(execArgs, "-fullpath")
+		if options.CoverageFormat != "" && coverProfile == "" {
+			aggregation.Warnings = append(aggregation.Warnings, "--coverage-format requires a coverage profile")
 		}
 
-		extraArgs := []string{}
+		// Failures are saved so they can be run again with --failed.
+		if options.Replay == "" && options.HomeDir != "" {
+			lastRunPath := c.LastRunPath(options.HomeDir, options.WorkingDir)
 
-		for _, arg := range flags.Args() {
-			if arg != "--" {
-				extraArgs = append(extraArgs, arg)
+			if err := c.NewLastRun(aggregation).Save(lastRunPath); err != nil {
+				aggregation.Warnings = append(aggregation.Warnings, "can't save the last run: "+err.Error())
 			}
 		}
 
-		execArgs = append(execArgs, extraArgs...)
+		if options.Replay == "" && timingsPath != "" {
+			timings, _ := c.LoadTimings(timingsPath)
+			timings.Update(aggregation)
 
-		if options.Raw {
-			execArgs = flags.Args()
+			if err := timings.Save(timingsPath); err != nil {
+				aggregation.Warnings = append(aggregation.Warnings, "can't save timings: "+err.Error())
+			}
 		}
 
+		if options.CoverageDiff != "" {
+			if coverProfile == "" {
+				aggregation.Warnings = append(aggregation.Warnings, "--coverage-diff requires a coverage profile")
+			} else if err := aggregation.LoadDiffCoverage(options.CoverageDiff); err != nil {
+				aggregation.Warnings = append(aggregation.Warnings, "can't compute coverage diff: "+err.Error())
+			}
+		}
+
+		reporterOptions := reporters.ReporterFinishedOptions{
+			Aggregation:  aggregation,
+			HideCoverage: options.HideCoverage,
+			HidePackages: options.HidePackages,
+			HideSlowest:  options.HideSlowest,
+			Debug:        options.Debug,
+		}
+
+		for _, reporter := range reporterList {
+			reporter.OnFinished(reporterOptions)
+		}
+
+		if options.OnFinished != nil {
+			options.OnFinished(aggregation)
+		}
+	}
+
+	if options.Replay == "" {
 		if options.Debug {
-			fmt.Fprintln(
-				output.Stdout,
-				c.Color.Detail("⚡️"),
-				"command:",
-				"go test",
-				strings.Join(execArgs, " "),
-			)
+			for _, commandArgs := range argsList {
+				fmt.Fprintln(
+					output.Stdout,
+					c.Color.Detail("⚡️"),
+					"command:",
+					"go test",
+					strings.Join(commandArgs, " "),
+				)
+			}
 		}
 
-		exitcode, err = Exec(&consumer, output, execArgs)
+		exitcode, err = ExecAll(&consumer, output, argsList, env, stop, hangTimeout)
 	} else {
 		exitcode, err = Replay(&consumer, &options)
 	}
@@ -298,63 +883,394 @@ func Run(args []string, options RunArgs, output *c.Output) int {
 		return 1
 	}
 
+	if consumer.Aggregation.Aborted != "" {
+		exitcode = max(exitcode, 1)
+	}
+
+	// The exit code only considers tests that failed every attempt.
+	if exitcode != 0 && consumer.Aggregation.Aborted == "" && consumer.Aggregation.CountBy("flaky") > 0 {
+		aggregation := consumer.Aggregation
+		failed := aggregation.CountBy("fail") > 0 ||
+			len(aggregation.BuildFailuresMap) > 0 ||
+			aggregation.FailedPackagesCount() > 0
+
+		if !failed {
+			exitcode = 0
+		}
+	}
+
+	if exitcode == 0 && len(consumer.Aggregation.CoverageGateFailures()) > 0 {
+		exitcode = 1
+	}
+
 	return exitcode
 }
 
+// Replay reads one or more comma-separated files, which may be gzipped. Use
+// "-" to read from stdin. Files can also be the output of the JSON reporter,
+// which are merged before the streams are read.
 func Replay(consumer *c.StreamConsumer, options *RunArgs) (int, error) {
-	stat, err := os.Stat(options.Replay)
+	scanners := []*bufio.Scanner{}
+
+	for _, replayPath := range strings.Split(options.Replay, ",") {
+		replayReader, err := openReplay(replayPath)
+
+		if err != nil {
+			return 1, err
+		}
+
+		defer replayReader.Close()
+		reader := bufio.NewReader(replayReader)
 
-	if os.IsNotExist(err) {
-		return 1, errors.New("replay file doesn't exist")
+		// The JSON reporter output is indented, unlike "go test -json" lines.
+		if start, _ := reader.Peek(2); string(start) == "{\n" {
+			contents, err := io.ReadAll(reader)
+
+			if err != nil {
+				return 1, err
+			}
+
+			report, err := c.ParseJSONReport(contents)
+
+			if err != nil {
+				return 1, fmt.Errorf("can't read JSON report (%s): %v", replayPath, err)
+			}
+
+			consumer.Aggregation.Merge(report)
+			continue
+		}
+
+		scanner := bufio.NewScanner(reader)
+		scanner.Split(bufio.ScanLines)
+		scanners = append(scanners, scanner)
 	}
 
-	if stat.IsDir() {
-		return 1, errors.New("can't read directory (" + options.Replay + ")")
+	consumer.Ingest(scanners...)
+
+	aggregation := consumer.Aggregation
+
+	return aggregation.CountBy("fail") + len(aggregation.BuildFailuresMap) + aggregation.FailedPackagesCount(), nil
+}
+
+type replayReader struct {
+	io.Reader
+	file *os.File
+}
+
+func (reader replayReader) Close() error {
+	if reader.file == os.Stdin {
+		return nil
 	}
 
-	file, err := os.Open(options.Replay)
+	return reader.file.Close()
+}
+
+func openReplay(replayPath string) (io.ReadCloser, error) {
+	file := os.Stdin
 
-	if err != nil {
-		return 1, err
+	if replayPath != "-" {
+		stat, err := os.Stat(replayPath)
+
+		if os.IsNotExist(err) {
+			return nil, errors.New("replay file doesn't exist")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if stat.IsDir() {
+			return nil, errors.New("can't read directory (" + replayPath + ")")
+		}
+
+		file, err = os.Open(replayPath)
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
+	reader := bufio.NewReader(file)
 
-	consumer.Ingest(scanner)
+	// gzip files are detected by their magic number, so compressed input can
+	// also be piped.
+	if magic, _ := reader.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gzipReader, err := gzip.NewReader(reader)
 
-	return consumer.Aggregation.CountBy("fail"), nil
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		reader = bufio.NewReader(gzipReader)
+	}
+
+	// Files created with --record start with a header, which must be skipped.
+	firstLine, _ := reader.ReadString('\n')
+	var input io.Reader = reader
+
+	if _, ok := c.ParseRecordHeader(firstLine); !ok {
+		input = io.MultiReader(strings.NewReader(firstLine), reader)
+	}
+
+	return replayReader{Reader: input, file: file}, nil
 }
 
-func Exec(consumer *c.StreamConsumer, output *c.Output, args []string) (int, error) {
-	args = append([]string{"test"}, args...)
-	cmd := exec.Command("go", args...)
-	cmd.Stderr = cmd.Stdout
-	out, _ := cmd.StdoutPipe()
-	scanner := bufio.NewScanner(out)
+// interruptedExitCode is the code used by shells for processes stopped with
+// Ctrl-C.
+const interruptedExitCode = 130
+
+func Exec(consumer *c.StreamConsumer, output *c.Output, args []string, env []string) (int, error) {
+	return ExecAll(consumer, output, [][]string{args}, env, nil, 0)
+}
+
+// ExecAll runs "go test" with each list of args in order, as a single stream.
+// A signal sent to stop is passed on to the running command, and the commands
+// that haven't started yet are skipped. The same happens on Ctrl-C, but the
+// run is reported as interrupted. When nothing is written for hangTimeout,
+// test binaries receive SIGQUIT, so they dump their goroutines and exit.
+func ExecAll(consumer *c.StreamConsumer, output *c.Output, argsList [][]string, env []string, stop <-chan os.Signal, hangTimeout time.Duration) (int, error) {
+	if _, err := exec.LookPath("go"); err != nil {
+		return 1, err
+	}
+
+	reader, writer := io.Pipe()
+	scanner := bufio.NewScanner(reader)
 	scanner.Split(bufio.ScanLines)
+	exitcode := 0
+	interrupted := false
+	var quitErr error
+	done := make(chan error, 1)
+	activity := make(chan struct{}, 1)
+	commandOutput := activityWriter{Writer: writer, activity: activity}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		defer writer.Close()
+
+		for _, args := range argsList {
+			select {
+			case <-stop:
+				done <- nil
+				return
+			case <-signals:
+				interrupted = true
+				done <- nil
+				return
+			default:
+			}
 
-	err := cmd.Start()
+			cmd := exec.Command("go", append([]string{"test"}, args...)...)
+			cmd.Env = append(os.Environ(), env...)
+			cmd.Stdout = commandOutput
+			cmd.Stderr = commandOutput
+			setProcessGroup(cmd)
 
-	if err != nil {
+			if err := cmd.Start(); err != nil {
+				done <- err
+				return
+			}
+
+			waited := make(chan error, 1)
+			stopped := false
+
+			go func() {
+				waited <- cmd.Wait()
+			}()
+
+			var err error
+			var hang <-chan time.Time
+			var hangTimer *time.Timer
+
+			if hangTimeout > 0 {
+				hangTimer = time.NewTimer(hangTimeout)
+				hang = hangTimer.C
+			}
+
+		wait:
+			for {
+				select {
+				case sig := <-stop:
+					stopped = true
+					signalProcessGroup(cmd, sig)
+				case sig := <-signals:
+					stopped = true
+					interrupted = true
+					signalProcessGroup(cmd, sig)
+				case <-activity:
+					if hangTimer != nil {
+						if !hangTimer.Stop() {
+							select {
+							case <-hangTimer.C:
+							default:
+							}
+						}
+
+						hangTimer.Reset(hangTimeout)
+					}
+				case <-hang:
+					if err := quitTestBinaries(cmd); err != nil && quitErr == nil {
+						quitErr = err
+					}
+
+					hangTimer.Reset(hangTimeout)
+				case err = <-waited:
+					break wait
+				}
+			}
+
+			if hangTimer != nil {
+				hangTimer.Stop()
+			}
+
+			if exiterr, ok := err.(*exec.ExitError); ok {
+				// Commands killed by a signal don't have an exit code.
+				exitcode = max(exitcode, exiterr.ExitCode(), 1)
+			} else if err != nil {
+				done <- err
+				return
+			}
+
+			if stopped {
+				break
+			}
+		}
+
+		done <- nil
+	}()
+
+	// The stream ends once commands exit, so whether they were interrupted or
+	// their test binaries couldn't be quit is known by the time the run
+	// finishes.
+	streamConsumer := *consumer
+	streamConsumer.OnFinished = func(aggregation *c.Aggregation) {
+		if interrupted {
+			streamConsumer.Abort("interrupted")
+		}
+
+		if quitErr != nil {
+			aggregation.Warnings = append(aggregation.Warnings, "can't quit hanging test binaries: "+quitErr.Error())
+		}
+
+		consumer.OnFinished(aggregation)
+	}
+
+	streamConsumer.Ingest(scanner)
+
+	// Whatever the scanner couldn't read must be drained, so commands can
+	// exit.
+	io.Copy(io.Discard, reader)
+
+	if err := <-done; err != nil {
 		return 1, err
 	}
 
-	consumer.Ingest(scanner)
+	if interrupted {
+		return interruptedExitCode, nil
+	}
+
+	return exitcode, nil
+}
+
+// activityWriter notifies whenever "go test" writes something, so hangs can be
+// detected.
+type activityWriter struct {
+	io.Writer
+	activity chan struct{}
+}
+
+func (writer activityWriter) Write(data []byte) (int, error) {
+	select {
+	case writer.activity <- struct{}{}:
+	default:
+	}
+
+	return writer.Writer.Write(data)
+}
 
-	err = cmd.Wait()
+// findNotRunPackages returns the packages that should have been tested, but
+// didn't even start.
+func findNotRunPackages(aggregation *c.Aggregation, testArgs []string, hasPackages bool, runs []testRun) ([]string, error) {
+	packages, err := plannedPackages(testArgs, hasPackages, runs)
 
 	if err != nil {
-		return 1, err
+		return nil, err
 	}
 
-	exitcode := 0
+	notRunPackages := []string{}
+
+	for _, pkg := range packages {
+		_, started := aggregation.PackagesMap[pkg]
+		_, failedBuild := aggregation.BuildFailuresMap[pkg]
+
+		if !started && !failedBuild && !slices.Contains(notRunPackages, pkg) {
+			notRunPackages = append(notRunPackages, pkg)
+		}
+	}
+
+	return notRunPackages, nil
+}
 
-	if exiterr, ok := err.(*exec.ExitError); ok {
-		exitcode = exiterr.ExitCode()
-		return exitcode, nil
+// plannedPackages returns the packages that are going to be tested, including
+// the ones that run separately (e.g. split across shards).
+func plannedPackages(testArgs []string, hasPackages bool, runs []testRun) ([]string, error) {
+	patterns, goTestArgs := splitPackages(testArgs)
+
+	if !hasPackages {
+		patterns = []string{}
+	} else if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	for _, run := range runs {
+		patterns = append(patterns, run.Packages...)
+	}
+
+	if len(patterns) == 0 {
+		return []string{}, nil
+	}
+
+	return c.ListPackages(patterns, buildArgs(goTestArgs))
+}
+
+// buildArgs returns the "go test" args that change which packages and files
+// are built.
+func buildArgs(goTestArgs []string) []string {
+	args := []string{}
+
+	if tags := findFlag(goTestArgs, "tags"); tags != "" {
+		args = append(args, "-tags="+tags)
+	}
+
+	return args
+}
+
+// findCoverProfile returns the profile path set with -coverprofile, if any.
+func findCoverProfile(args []string) string {
+	return findFlag(args, "coverprofile")
+}
+
+// findFlag returns the value of a "go test" flag, if any. Flags can also be
+// prefixed with "test.".
+func findFlag(args []string, flagName string) string {
+	for index, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		if name != flagName && name != "test."+flagName {
+			continue
+		}
+
+		if hasValue {
+			return value
+		}
+
+		if index+1 < len(args) {
+			return args[index+1]
+		}
 	}
 
-	return exitcode, err
+	return ""
 }
@@ -0,0 +1,405 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	c "github.com/fnando/bolt/common"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+var watchUsage string = `
+Run tests whenever files change.
+
+Only the packages affected by the changed files are tested again, which
+includes the packages that depend on them. Files inside testdata directories
+are also watched.
+
+  Usage: bolt watch [options] [packages...] -- [additional "go test" arguments]
+
+  Options:
+%s
+
+  Keyboard shortcuts:
+    a    Run all tests
+    f    Run failed tests
+    q    Quit
+
+  All options from "bolt run" are also supported (see "bolt run --help").
+`
+
+type watchedFile struct {
+	ModTime time.Time
+	Size    int64
+}
+
+type watchedPackage struct {
+	ImportPath string
+	Dir        string
+	Deps       []string
+}
+
+func Watch(args []string, options RunArgs, output *c.Output) int {
+	flags := newRunFlags(&options)
+	interval := flags.Duration("interval", 500*time.Millisecond, "How often files are checked for changes")
+	flags.SetOutput(bufio.NewWriter(&bytes.Buffer{}))
+	err := flags.Parse(args)
+
+	if err == flag.ErrHelp {
+		watchFlags := flag.NewFlagSet("bolt watch", flag.ContinueOnError)
+		watchFlags.Var(flags.Lookup("interval").Value, "interval", flags.Lookup("interval").Usage)
+		fmt.Fprintf(output.Stdout, watchUsage, getFlagsUsage(watchFlags))
+		return 0
+	} else if err != nil {
+		fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+		return 1
+	}
+
+	if options.Replay != "" {
+		fmt.Fprintf(output.Stderr, "%s %s\n", c.Color.Fail("ERROR:"), "--replay can't be used with watch")
+		return 1
+	}
+
+	// Options are forwarded to "bolt run", except the ones that only make
+	// sense when watching.
+	runArgs := []string{}
+
+	flags.Visit(func(flag *flag.Flag) {
+		if flag.Name != "interval" {
+			runArgs = append(runArgs, "--"+flag.Name+"="+flag.Value.String())
+		}
+	})
+
+	patterns, goTestArgs := splitPackages(flags.Args())
+
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	lastRun := c.LastRun{}
+
+	run := func(packages []string, runs ...testRun) {
+		runOptions := options
+		runOptions.runs = runs
+		runOptions.OnFinished = func(aggregation *c.Aggregation) {
+			lastRun = c.NewLastRun(aggregation)
+		}
+
+		execArgs := append([]string{}, runArgs...)
+		execArgs = append(execArgs, "--")
+		execArgs = append(execArgs, packages...)
+		execArgs = append(execArgs, goTestArgs...)
+
+		Run(execArgs, runOptions, output)
+
+		fmt.Fprintf(
+			output.Stdout,
+			"\n%s\n",
+			c.Color.Detail("Watching for changes. Press a to run all tests, f to run failed tests, q to quit."),
+		)
+	}
+
+	restore := setTerminalRawMode()
+	defer restore()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	keys := make(chan byte)
+	go readKeys(keys)
+
+	files := map[string]watchedFile{}
+	scanFiles(options.WorkingDir, files)
+	run(patterns)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			return 130
+
+		case key, ok := <-keys:
+			if !ok {
+				// stdin has been closed, so only file changes are handled.
+				keys = nil
+				continue
+			}
+
+			switch key {
+			case 'q':
+				return 0
+
+			case 'a':
+				run(patterns)
+
+			case 'f':
+				if len(lastRun.Failures) == 0 {
+					fmt.Fprintln(output.Stdout, c.Color.Detail("No failed tests to run."))
+					continue
+				}
+
+				packages, runs := failedRuns(lastRun)
+				run(packages, runs...)
+			}
+
+		case <-ticker.C:
+			changed := scanFiles(options.WorkingDir, files)
+
+			if len(changed) == 0 {
+				continue
+			}
+
+			packages, err := affectedPackages(options.WorkingDir, patterns, changed)
+
+			if err != nil {
+				fmt.Fprintf(output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+				continue
+			}
+
+			if len(packages) == 0 {
+				continue
+			}
+
+			run(packages)
+
+			// Tests may write files themselves (e.g. golden files), which must
+			// not trigger another run.
+			scanFiles(options.WorkingDir, files)
+		}
+	}
+}
+
+// splitPackages separates the package patterns from the "go test" arguments
+// that follow them.
+func splitPackages(args []string) (packages []string, goTestArgs []string) {
+	for _, arg := range args {
+		if arg == "--" {
+			continue
+		}
+
+		if len(goTestArgs) == 0 && !strings.HasPrefix(arg, "-") {
+			packages = append(packages, arg)
+		} else {
+			goTestArgs = append(goTestArgs, arg)
+		}
+	}
+
+	return packages, goTestArgs
+}
+
+// scanFiles updates the list of watched files, returning the ones that have
+// been added, changed or removed since the last scan.
+func scanFiles(root string, files map[string]watchedFile) []string {
+	changed := []string{}
+	seen := map[string]bool{}
+
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		name := entry.Name()
+
+		if entry.IsDir() {
+			ignore := path != root && (strings.HasPrefix(name, ".") ||
+				strings.HasPrefix(name, "_") ||
+				name == "vendor" ||
+				name == "node_modules")
+
+			if ignore {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if filepath.Ext(name) != ".go" && !inTestdata(path) {
+			return nil
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			return nil
+		}
+
+		seen[path] = true
+		file := watchedFile{ModTime: info.ModTime(), Size: info.Size()}
+
+		if previous, exists := files[path]; !exists || previous != file {
+			files[path] = file
+			changed = append(changed, path)
+		}
+
+		return nil
+	})
+
+	for path := range files {
+		if !seen[path] {
+			delete(files, path)
+			changed = append(changed, path)
+		}
+	}
+
+	return changed
+}
+
+func inTestdata(path string) bool {
+	return slices.Contains(strings.Split(filepath.ToSlash(path), "/"), "testdata")
+}
+
+// packageDir returns the directory of the package a file belongs to. Files
+// inside testdata belong to the package that contains the testdata directory.
+func packageDir(path string) string {
+	dir := filepath.Dir(path)
+
+	for inTestdata(dir) {
+		dir = filepath.Dir(dir)
+	}
+
+	return dir
+}
+
+// affectedPackages returns the packages matching the patterns that either
+// contain the changed files or depend on a package that does, including
+// dependencies imported by tests only.
+func affectedPackages(workingDir string, patterns []string, changedFiles []string) ([]string, error) {
+	args := []string{"list", "-e", "-deps", "-test", "-f", "{{if not .DepOnly}}{{.ImportPath}}\t{{.Dir}}\t{{join .Deps \" \"}}{{end}}"}
+	cmd := exec.Command("go", append(args, patterns...)...)
+	cmd.Dir = workingDir
+	out, err := cmd.Output()
+
+	if err != nil {
+		return nil, fmt.Errorf("can't list packages: %v", err)
+	}
+
+	packages := []watchedPackage{}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.Split(line, "\t")
+
+		if len(parts) != 3 {
+			continue
+		}
+
+		packages = append(packages, watchedPackage{
+			ImportPath: parts[0],
+			Dir:        parts[1],
+			Deps:       strings.Fields(parts[2]),
+		})
+	}
+
+	changedDirs := map[string]bool{}
+
+	for _, path := range changedFiles {
+		changedDirs[packageDir(path)] = true
+	}
+
+	changedPackages := map[string]bool{}
+
+	for _, pkg := range packages {
+		if changedDirs[pkg.Dir] {
+			changedPackages[testedPackage(pkg.ImportPath)] = true
+		}
+	}
+
+	affected := map[string]bool{}
+
+	for _, pkg := range packages {
+		name := testedPackage(pkg.ImportPath)
+
+		// The generated test main package depends on everything and would
+		// make every package look affected.
+		if strings.HasSuffix(name, ".test") {
+			continue
+		}
+
+		if changedPackages[name] {
+			affected[name] = true
+			continue
+		}
+
+		for _, dep := range pkg.Deps {
+			if changedPackages[testedPackage(dep)] {
+				affected[name] = true
+				break
+			}
+		}
+	}
+
+	result := maps.Keys(affected)
+	slices.Sort(result)
+
+	return result, nil
+}
+
+// testedPackage turns the import path of a test variant, like
+// "example.com/pkg_test [example.com/pkg.test]", into the package being tested.
+func testedPackage(importPath string) string {
+	name, _, _ := strings.Cut(importPath, " ")
+
+	return strings.TrimSuffix(name, "_test")
+}
+
+// readKeys sends every byte read from stdin to the channel, which is closed
+// once stdin is closed.
+func readKeys(keys chan<- byte) {
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		key, err := reader.ReadByte()
+
+		if err != nil {
+			close(keys)
+			return
+		}
+
+		keys <- key
+	}
+}
+
+// setTerminalRawMode makes keys available without having to press enter,
+// returning a function that restores the terminal. Nothing happens when
+// stdin isn't a terminal.
+func setTerminalRawMode() func() {
+	stat, err := os.Stdin.Stat()
+
+	if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return func() {}
+	}
+
+	stty := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+
+		return cmd.Output()
+	}
+
+	state, err := stty("-g")
+
+	if err != nil {
+		return func() {}
+	}
+
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return func() {}
+	}
+
+	return func() {
+		stty(strings.TrimSpace(string(state)))
+	}
+}
@@ -0,0 +1,154 @@
+package reporters
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+
+	c "github.com/fnando/bolt/common"
+)
+
+// CoberturaReporter writes the coverage profile using the Cobertura XML
+// format. Rates are based on statements, so they match what bolt prints.
+type CoberturaReporter struct {
+	Output     *c.Output
+	Path       string
+	WorkingDir string
+}
+
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        float64            `xml:"line-rate,attr"`
+	BranchRate      float64            `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      float64            `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   float64          `xml:"line-rate,attr"`
+	BranchRate float64          `xml:"branch-rate,attr"`
+	Complexity float64          `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string            `xml:"name,attr"`
+	Filename   string            `xml:"filename,attr"`
+	LineRate   float64           `xml:"line-rate,attr"`
+	BranchRate float64           `xml:"branch-rate,attr"`
+	Complexity float64           `xml:"complexity,attr"`
+	Methods    []coberturaMethod `xml:"methods>method"`
+	Lines      []coberturaLine   `xml:"lines>line"`
+}
+
+type coberturaMethod struct {
+	Name       string          `xml:"name,attr"`
+	Signature  string          `xml:"signature,attr"`
+	LineRate   float64         `xml:"line-rate,attr"`
+	BranchRate float64         `xml:"branch-rate,attr"`
+	Complexity float64         `xml:"complexity,attr"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+func (reporter CoberturaReporter) Name() string {
+	return "cobertura"
+}
+
+func (reporter CoberturaReporter) OnFinished(options ReporterFinishedOptions) {
+	report := coberturaCoverage{
+		Version:   "bolt " + c.Version,
+		Timestamp: options.Aggregation.EndedAt.UnixMilli(),
+		Sources:   []string{reporter.WorkingDir},
+		Packages:  []coberturaPackage{},
+	}
+
+	for _, coverage := range options.Aggregation.AllCoverages() {
+		if len(coverage.Files) == 0 {
+			continue
+		}
+
+		pkg := coberturaPackage{Name: coverage.Package, Classes: []coberturaClass{}}
+		statements, covered := 0, 0
+
+		for _, file := range coverage.Files {
+			lines := []coberturaLine{}
+
+			for _, line := range file.Lines() {
+				lines = append(lines, coberturaLine{Number: line.Line, Hits: line.Hits})
+			}
+
+			class := coberturaClass{
+				Name:     path.Base(file.File),
+				Filename: coverageFilePath(file, reporter.WorkingDir),
+				LineRate: rate(file.Covered, file.Statements),
+				Methods:  []coberturaMethod{},
+				Lines:    lines,
+			}
+
+			for _, function := range file.Functions {
+				method := coberturaMethod{
+					Name:     function.Name,
+					LineRate: rate(function.Covered, function.Statements),
+					Lines:    []coberturaLine{},
+				}
+
+				for _, line := range lines {
+					if line.Number >= function.Line && line.Number <= function.EndLine {
+						method.Lines = append(method.Lines, line)
+					}
+				}
+
+				class.Methods = append(class.Methods, method)
+			}
+
+			pkg.Classes = append(pkg.Classes, class)
+			statements += file.Statements
+			covered += file.Covered
+		}
+
+		pkg.LineRate = rate(covered, statements)
+		report.Packages = append(report.Packages, pkg)
+		report.LinesValid += statements
+		report.LinesCovered += covered
+	}
+
+	report.LineRate = rate(report.LinesCovered, report.LinesValid)
+
+	contents, _ := xml.MarshalIndent(report, "", "  ")
+	contents = append([]byte(xml.Header), contents...)
+	contents = append(contents, '\n')
+
+	err := os.WriteFile(reporter.Path, contents, 0644)
+
+	if err != nil {
+		fmt.Fprintf(reporter.Output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+	}
+}
+
+func (reporter CoberturaReporter) OnProgress(test c.Test) {
+}
+
+func (reporter CoberturaReporter) OnData(line string) {
+}
+
+func rate(covered int, statements int) float64 {
+	if statements == 0 {
+		return 1
+	}
+
+	return float64(covered) / float64(statements)
+}
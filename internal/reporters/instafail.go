@@ -0,0 +1,113 @@
+package reporters
+
+import (
+	"encoding/json"
+
+	c "github.com/fnando/bolt/common"
+)
+
+// Instafail formats failures as soon as they happen, the same way they're
+// shown in the final report. Failures are numbered in the order they happen.
+//
+// A test that panics fails before its panic is printed, so failures are held
+// back until their package runs another test (it didn't die) or finishes.
+// Tests are then read from the aggregation, which has the panic by then.
+type Instafail struct {
+	FullTrace   bool
+	Aggregation *c.Aggregation
+	count       int
+	held        []c.Test
+	finished    []string
+}
+
+// OnProgress holds back failed tests, returning the failures that can be
+// printed already.
+func (instafail *Instafail) OnProgress(test c.Test) string {
+	output := instafail.releaseFinished()
+
+	if test.Status == "fail" {
+		instafail.held = append(instafail.held, test)
+	}
+
+	return output
+}
+
+// OnData releases the failures of a package when it runs another test.
+// When the package finishes, its failures are released with the next line,
+// once the package's output has been processed.
+func (instafail *Instafail) OnData(line string) string {
+	output := instafail.releaseFinished()
+
+	var stream c.Stream
+
+	if json.Unmarshal([]byte(line), &stream) != nil || stream.Package == "" {
+		return output
+	}
+
+	switch {
+	case stream.Action == "run":
+		output += instafail.release(func(pkg string) bool { return pkg == stream.Package })
+
+	case stream.Test == "" && (stream.Action == "pass" || stream.Action == "fail" || stream.Action == "skip"):
+		instafail.finished = append(instafail.finished, stream.Package)
+	}
+
+	return output
+}
+
+// Flush returns the failures that are still held back.
+func (instafail *Instafail) Flush() string {
+	instafail.finished = nil
+
+	return instafail.release(func(pkg string) bool { return true })
+}
+
+func (instafail *Instafail) releaseFinished() string {
+	if len(instafail.finished) == 0 {
+		return ""
+	}
+
+	finished := instafail.finished
+	instafail.finished = nil
+
+	return instafail.release(func(pkg string) bool {
+		for _, name := range finished {
+			if name == pkg {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+func (instafail *Instafail) release(matches func(pkg string) bool) string {
+	output := ""
+	held := []c.Test{}
+
+	for _, test := range instafail.held {
+		if !matches(test.Package) {
+			held = append(held, test)
+			continue
+		}
+
+		output += instafail.format(test)
+	}
+
+	instafail.held = held
+
+	return output
+}
+
+func (instafail *Instafail) format(test c.Test) string {
+	if instafail.Aggregation != nil {
+		if current, exists := instafail.Aggregation.TestsMap[test.Key]; exists {
+			test = *current
+		}
+	}
+
+	instafail.count += 1
+	reporter := ProgressReporter{FullTrace: instafail.FullTrace}
+
+	return "\n" + reporter.formatTest(&test, instafail.count) + "\n"
+}
@@ -12,10 +12,18 @@ type JSONReporter struct {
 }
 
 type JSONData struct {
-	Coverage   []*c.Coverage
-	Tests      []*c.Test
-	Benchmarks []*c.Benchmark
-	Elapsed    float64
+	Coverage       []*c.Coverage
+	CoverageGate   []c.CoverageGateFailure
+	DiffCoverage   *c.DiffCoverage
+	Packages       []*c.Package
+	Tests          []*c.Test
+	Benchmarks     []*c.Benchmark
+	BuildFailures  []*c.BuildFailure
+	OrphanOutput   []string
+	Warnings       []string
+	Aborted        string   `json:",omitempty"`
+	NotRunPackages []string `json:",omitempty"`
+	Elapsed        float64
 }
 
 func (reporter JSONReporter) Name() string {
@@ -24,10 +32,18 @@ func (reporter JSONReporter) Name() string {
 
 func (reporter JSONReporter) OnFinished(options ReporterFinishedOptions) {
 	data := JSONData{
-		Coverage:   options.Aggregation.Coverages(),
-		Tests:      options.Aggregation.Tests(),
-		Benchmarks: options.Aggregation.Benchmarks(),
-		Elapsed:    float64(options.Aggregation.Elapsed()),
+		Coverage:       options.Aggregation.Coverages(),
+		CoverageGate:   options.Aggregation.CoverageGateFailures(),
+		DiffCoverage:   options.Aggregation.DiffCoverage,
+		Packages:       options.Aggregation.Packages(),
+		Tests:          options.Aggregation.Tests(),
+		Benchmarks:     options.Aggregation.Benchmarks(),
+		BuildFailures:  options.Aggregation.BuildFailures(),
+		OrphanOutput:   options.Aggregation.OrphanOutput,
+		Warnings:       options.Aggregation.Warnings,
+		Aborted:        options.Aggregation.Aborted,
+		NotRunPackages: options.Aggregation.NotRunPackages,
+		Elapsed:        float64(options.Aggregation.Elapsed()),
 	}
 	contents, _ := json.MarshalIndent(data, "", "  ")
 	fmt.Fprintln(reporter.Output.Stdout, string(contents))
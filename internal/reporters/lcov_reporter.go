@@ -0,0 +1,95 @@
+package reporters
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	c "github.com/fnando/bolt/common"
+)
+
+// LCOVReporter writes the coverage profile using the LCOV tracefile format.
+type LCOVReporter struct {
+	Output     *c.Output
+	Path       string
+	WorkingDir string
+}
+
+func (reporter LCOVReporter) Name() string {
+	return "lcov"
+}
+
+func (reporter LCOVReporter) OnFinished(options ReporterFinishedOptions) {
+	var builder strings.Builder
+
+	for _, coverage := range options.Aggregation.AllCoverages() {
+		for _, file := range coverage.Files {
+			builder.WriteString("TN:\n")
+			builder.WriteString("SF:" + coverageFilePath(file, reporter.WorkingDir) + "\n")
+
+			functionsHit := 0
+
+			for _, function := range file.Functions {
+				builder.WriteString(fmt.Sprintf("FN:%d,%s\n", function.Line, function.Name))
+			}
+
+			for _, function := range file.Functions {
+				hits := 0
+
+				if function.Covered > 0 {
+					hits = 1
+					functionsHit += 1
+				}
+
+				builder.WriteString(fmt.Sprintf("FNDA:%d,%s\n", hits, function.Name))
+			}
+
+			builder.WriteString(fmt.Sprintf("FNF:%d\n", len(file.Functions)))
+			builder.WriteString(fmt.Sprintf("FNH:%d\n", functionsHit))
+
+			lines := file.Lines()
+			linesHit := 0
+
+			for _, line := range lines {
+				if line.Hits > 0 {
+					linesHit += 1
+				}
+
+				builder.WriteString(fmt.Sprintf("DA:%d,%d\n", line.Line, line.Hits))
+			}
+
+			builder.WriteString(fmt.Sprintf("LF:%d\n", len(lines)))
+			builder.WriteString(fmt.Sprintf("LH:%d\n", linesHit))
+			builder.WriteString("end_of_record\n")
+		}
+	}
+
+	err := os.WriteFile(reporter.Path, []byte(builder.String()), 0644)
+
+	if err != nil {
+		fmt.Fprintf(reporter.Output.Stderr, "%s %v\n", c.Color.Fail("ERROR:"), err)
+	}
+}
+
+func (reporter LCOVReporter) OnProgress(test c.Test) {
+}
+
+func (reporter LCOVReporter) OnData(line string) {
+}
+
+// coverageFilePath returns the file's path relative to the working dir. When
+// the file can't be found, the import path is used instead.
+func coverageFilePath(file *c.FileCoverage, workingDir string) string {
+	if file.Path() == "" {
+		return file.File
+	}
+
+	relativePath, err := filepath.Rel(workingDir, file.Path())
+
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		return file.Path()
+	}
+
+	return filepath.ToSlash(relativePath)
+}
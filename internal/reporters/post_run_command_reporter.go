@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strings"
 
 	c "github.com/fnando/bolt/common"
 )
@@ -28,34 +29,67 @@ func (reporter PostRunCommandReporter) OnFinished(options ReporterFinishedOption
 	fail := options.Aggregation.CountBy("fail")
 	pass := options.Aggregation.CountBy("pass")
 	skip := options.Aggregation.CountBy("skip")
+	flaky := options.Aggregation.CountBy("flaky")
 	benchmarks := len(options.Aggregation.Benchmarks())
+	examples := options.Aggregation.CountByKind("example")
+	fuzz := options.Aggregation.CountByKind("fuzz")
+	buildFailures := len(options.Aggregation.BuildFailures())
 	elapsed := options.Aggregation.Elapsed()
 	elapsedNS := int(elapsed)
+	gateFailures := options.Aggregation.CoverageGateFailures()
+	status := options.Aggregation.Status()
 	title := "Passed!"
+	summary := fmt.Sprintf(
+		"Finished in %s, %d tests, %d fails, %d skips, %d benchmarks",
+		formatDuration(elapsed, 2),
+		total,
+		fail,
+		skip,
+		benchmarks,
+	)
 
-	if fail > 0 {
+	// The title follows the status, so it matches bolt's exit code (e.g. a
+	// package can fail in TestMain without any failing tests).
+	switch status {
+	case "fail":
 		title = "Failed!"
+	case "interrupted":
+		title = "Interrupted!"
+	}
+
+	if flaky > 0 {
+		summary += fmt.Sprintf(", %d flaky", flaky)
+	}
+
+	if len(gateFailures) > 0 {
+		summary += ", coverage gate failed"
+	}
+
+	gateMessages := []string{}
+
+	for _, failure := range gateFailures {
+		gateMessages = append(gateMessages, failure.String())
 	}
 
 	env := os.Environ()
 	env = append(
 		env,
-		fmt.Sprintf(
-			"BOLT_SUMMARY=Finished in %s, %d tests, %d fails, %d skips, %d benchmarks",
-			formatDuration(elapsed, 2),
-			total,
-			fail,
-			skip,
-			benchmarks,
-		),
+		fmt.Sprintf("BOLT_SUMMARY=%s", summary),
 		fmt.Sprintf("BOLT_TEST_COUNT=%d", total),
 		fmt.Sprintf("BOLT_FAIL_COUNT=%d", fail),
 		fmt.Sprintf("BOLT_PASS_COUNT=%d", pass),
 		fmt.Sprintf("BOLT_SKIP_COUNT=%d", skip),
+		fmt.Sprintf("BOLT_FLAKY_COUNT=%d", flaky),
 		fmt.Sprintf("BOLT_BENCHMARK_COUNT=%d", benchmarks),
+		fmt.Sprintf("BOLT_EXAMPLE_COUNT=%d", examples),
+		fmt.Sprintf("BOLT_FUZZ_COUNT=%d", fuzz),
+		fmt.Sprintf("BOLT_BUILD_FAILURE_COUNT=%d", buildFailures),
+		fmt.Sprintf("BOLT_COVERAGE_GATE_FAILURE_COUNT=%d", len(gateFailures)),
+		fmt.Sprintf("BOLT_COVERAGE_GATE_FAILURES=%s", strings.Join(gateMessages, "\n")),
 		fmt.Sprintf("BOLT_ELAPSED_NANOSECONDS=%d", elapsedNS),
 		fmt.Sprintf("BOLT_ELAPSED=%s", formatDuration(elapsed, 2)),
 		fmt.Sprintf("BOLT_TITLE=%s", title),
+		fmt.Sprintf("BOLT_STATUS=%s", status),
 	)
 
 	var buffer bytes.Buffer
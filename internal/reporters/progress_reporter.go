@@ -3,6 +3,7 @@ package reporters
 import (
 	"fmt"
 	"os"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -12,10 +13,15 @@ import (
 	c "github.com/fnando/bolt/common"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 type ProgressReporter struct {
-	Output *c.Output
+	Output     *c.Output
+	FullTrace  bool
+	StatusLine *StatusLine
+	Instafail  *Instafail
 }
 
 func (reporter ProgressReporter) Name() string {
@@ -23,13 +29,32 @@ func (reporter ProgressReporter) Name() string {
 }
 
 func (reporter ProgressReporter) OnFinished(options ReporterFinishedOptions) {
+	if reporter.Instafail != nil {
+		reporter.print(reporter.Instafail.Flush())
+	}
+
+	if reporter.StatusLine != nil {
+		reporter.StatusLine.Stop()
+	}
+
 	reporter.PrintTests(options.Aggregation)
+	reporter.PrintOrphanOutput(options.Aggregation)
+	reporter.PrintWarnings(options.Aggregation)
+	reporter.PrintBuildFailures(options.Aggregation)
 	reporter.PrintBenchmarks(options.Aggregation)
 	reporter.PrintSummary(options.Aggregation)
+	reporter.PrintAborted(options.Aggregation)
+
+	if !options.HidePackages {
+		reporter.PrintPackages(options.Aggregation)
+	}
+
+	reporter.PrintCoverageGate(options.Aggregation)
 
 	if options.Aggregation.CountBy("failed") == 0 {
 		if !options.HideCoverage {
 			reporter.PrintCoverage(options.Aggregation)
+			reporter.PrintDiffCoverage(options.Aggregation)
 		}
 
 		if !options.HideSlowest {
@@ -41,24 +66,139 @@ func (reporter ProgressReporter) OnFinished(options ReporterFinishedOptions) {
 func (reporter ProgressReporter) PrintSummary(aggregation *c.Aggregation) {
 	testsCount := aggregation.TestsCount()
 	failCount := aggregation.CountBy("fail")
+	flakyCount := aggregation.CountBy("flaky")
 	skipCount := aggregation.CountBy("skip")
 	benchmarksCount := len(aggregation.Benchmarks())
+	examplesCount := aggregation.CountByKind("example")
+	fuzzCount := aggregation.CountByKind("fuzz")
+	buildFailuresCount := len(aggregation.BuildFailures())
 
 	summary := fmt.Sprintf(
-		"\nFinished in %s, %d tests, %d failures, %d skips, %d benchmarks\n",
+		"\nFinished in %s, %d tests, %d failures",
 		formatDuration(aggregation.Elapsed(), 0),
 		testsCount,
 		failCount,
-		skipCount,
-		benchmarksCount,
 	)
 
+	if flakyCount > 0 {
+		summary += fmt.Sprintf(", %d flaky", flakyCount)
+	}
+
+	summary += fmt.Sprintf(", %d skips, %d benchmarks", skipCount, benchmarksCount)
+
+	if examplesCount > 0 {
+		summary += fmt.Sprintf(", %d examples", examplesCount)
+	}
+
+	if fuzzCount > 0 {
+		summary += fmt.Sprintf(", %d fuzz targets", fuzzCount)
+	}
+
+	if buildFailuresCount > 0 {
+		summary += fmt.Sprintf(", %d build failures", buildFailuresCount)
+	}
+
+	if len(aggregation.CoverageGateFailures()) > 0 {
+		summary += ", coverage gate failed"
+	}
+
+	summary += "\n"
+
 	fmt.Fprintf(
 		reporter.Output.Stdout,
 		c.Color.Apply(c.Color.Color(aggregation.Status()), summary),
 	)
 }
 
+func (reporter ProgressReporter) PrintAborted(aggregation *c.Aggregation) {
+	if aggregation.Aborted == "" {
+		return
+	}
+
+	message := fmt.Sprintf(
+		"Run aborted after the first failure, %d packages never ran.",
+		len(aggregation.NotRunPackages),
+	)
+
+	if aggregation.Aborted == "interrupted" {
+		message = fmt.Sprintf(
+			"Run interrupted, %d packages never ran.",
+			len(aggregation.NotRunPackages),
+		)
+	}
+
+	fmt.Fprintln(reporter.Output.Stdout, c.Color.Apply(c.Color.Color(aggregation.Status()), message))
+
+	tests := aggregation.InterruptedTests()
+
+	if aggregation.Aborted != "interrupted" || len(tests) == 0 {
+		return
+	}
+
+	fmt.Fprint(reporter.Output.Stdout, "\n"+c.Color.Text("Tests running when interrupted:")+"\n")
+
+	for _, test := range tests {
+		fmt.Fprintf(
+			reporter.Output.Stdout,
+			"  %s %s\n",
+			c.Color.Text(test.Name),
+			c.Color.Detail("("+test.Package+")"),
+		)
+	}
+}
+
+func (reporter ProgressReporter) PrintOrphanOutput(aggregation *c.Aggregation) {
+	if len(aggregation.OrphanOutput) == 0 {
+		return
+	}
+
+	fmt.Fprintln(reporter.Output.Stdout)
+
+	for _, line := range aggregation.OrphanOutput {
+		fmt.Fprintln(reporter.Output.Stdout, c.Color.Text(line))
+	}
+}
+
+func (reporter ProgressReporter) PrintWarnings(aggregation *c.Aggregation) {
+	if len(aggregation.Warnings) == 0 {
+		return
+	}
+
+	fmt.Fprint(reporter.Output.Stdout, "\n"+c.Color.Text("Warnings:")+"\n")
+
+	for _, warning := range aggregation.Warnings {
+		fmt.Fprintln(reporter.Output.Stdout, "  "+c.Color.Skip(warning))
+	}
+}
+
+func (reporter ProgressReporter) PrintBuildFailures(aggregation *c.Aggregation) {
+	failures := aggregation.BuildFailures()
+
+	if len(failures) == 0 {
+		return
+	}
+
+	fmt.Fprint(reporter.Output.Stdout, "\n"+c.Color.Text("Build failures:")+"\n")
+
+	for _, failure := range failures {
+		output := "\n" + c.Color.Fail(failure.Package) + "\n"
+
+		for _, buildError := range failure.Errors {
+			output += "  " + c.Color.Detail(buildError.Location()) + " " + c.Color.Text(buildError.Message) + "\n"
+		}
+
+		// Nothing was recognized as a compiler error (e.g. a failure caused by
+		// a dependency), so let's show whatever was printed.
+		if len(failure.Errors) == 0 {
+			for _, line := range failure.Output {
+				output += "  " + c.Color.Text(line) + "\n"
+			}
+		}
+
+		fmt.Fprint(reporter.Output.Stdout, output)
+	}
+}
+
 func (reporter ProgressReporter) PrintBenchmarks(aggregation *c.Aggregation) {
 	benchmarks := aggregation.Benchmarks()
 
@@ -68,22 +208,126 @@ func (reporter ProgressReporter) PrintBenchmarks(aggregation *c.Aggregation) {
 
 	fmt.Fprint(reporter.Output.Stdout, "\n"+c.Color.Text("Benchmarks:")+"\n\n")
 
+	metrics := reporter.benchmarkMetrics(benchmarks)
+	columns := []table.ColumnConfig{
+		{Number: 1},
+		{Number: 2, Align: text.AlignRight},
+		{Number: 3, Align: text.AlignRight},
+	}
+	header := table.Row{"Name", "Iterations", "Time/op"}
+
+	for index, metric := range metrics {
+		columns = append(columns, table.ColumnConfig{Number: index + 4, Align: text.AlignRight})
+		header = append(header, metric)
+	}
+
 	t := table.NewWriter()
 	t.Style().Format.Header = text.FormatTitle
+	t.SetColumnConfigs(columns)
+	t.SetOutputMirror(reporter.Output.Stdout)
+	t.AppendHeader(header)
+
+	for _, benchmark := range benchmarks {
+		row := table.Row{
+			fmt.Sprintf("%s-%d", benchmark.Name, benchmark.Processors),
+			h.Comma(int64(benchmark.Iterations)),
+			formatDuration(benchmark.DurationPerOperation, 2),
+		}
+
+		for _, metric := range metrics {
+			value, exists := benchmark.Metrics[metric]
+
+			if !exists {
+				row = append(row, "-")
+			} else if metric == "B/op" || metric == "allocs/op" {
+				row = append(row, h.Comma(int64(value)))
+			} else {
+				row = append(row, h.CommafWithDigits(value, 2))
+			}
+		}
+
+		t.AppendRow(row)
+	}
+
+	t.Render()
+}
+
+// benchmarkMetrics returns the metrics reported by any of the benchmarks,
+// other than ns/op, which is always displayed.
+func (reporter ProgressReporter) benchmarkMetrics(benchmarks []*c.Benchmark) []string {
+	known := []string{"B/op", "allocs/op", "MB/s"}
+	custom := []string{}
+	found := map[string]bool{}
+
+	for _, benchmark := range benchmarks {
+		for metric := range benchmark.Metrics {
+			found[metric] = true
+		}
+	}
+
+	for metric := range found {
+		if metric != "ns/op" && !slices.Contains(known, metric) {
+			custom = append(custom, metric)
+		}
+	}
+
+	slices.Sort(custom)
+	metrics := []string{}
+
+	for _, metric := range known {
+		if found[metric] {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return append(metrics, custom...)
+}
+
+func (reporter ProgressReporter) PrintPackages(aggregation *c.Aggregation) {
+	packages := aggregation.Packages()
+
+	if len(packages) == 0 {
+		return
+	}
+
+	fmt.Fprint(reporter.Output.Stdout, "\n"+c.Color.Text("Packages:")+"\n\n")
+
+	t := table.NewWriter()
 	t.Style().Format.Header = text.FormatTitle
 	t.SetColumnConfigs([]table.ColumnConfig{
 		{Number: 1},
-		{Number: 2, Align: text.AlignRight},
+		{Number: 2},
 		{Number: 3, Align: text.AlignRight},
+		{Number: 4, Align: text.AlignRight},
+		{Number: 5, Align: text.AlignRight},
+		{Number: 6, Align: text.AlignRight},
+		{Number: 7, Align: text.AlignRight},
 	})
 	t.SetOutputMirror(reporter.Output.Stdout)
-	t.AppendHeader(table.Row{"Name", "Iterations", "Time/op"})
+	t.AppendHeader(table.Row{"Package", "Status", "Tests", "Failures", "Skips", "Coverage", "Time"})
+
+	for _, pkg := range packages {
+		status := pkg.Status
+		elapsed := formatDuration(pkg.Elapsed, 2)
+		coverage := fmt.Sprintf("%.1f%%", pkg.Coverage)
+
+		if pkg.NoTestFiles {
+			status = "no test files"
+			coverage = "-"
+		}
+
+		if pkg.Cached {
+			elapsed = "(cached)"
+		}
 
-	for _, benchmark := range benchmarks {
 		t.AppendRow([]interface{}{
-			fmt.Sprintf("%s-%d", benchmark.Name, benchmark.Processors),
-			h.Comma(int64(benchmark.Iterations)),
-			formatDuration(benchmark.DurationPerOperation, 2),
+			pkg.Name,
+			c.Color.Apply(c.Color.Color(pkg.Status), status),
+			pkg.TestsCount,
+			pkg.FailCount,
+			pkg.SkipCount,
+			coverage,
+			elapsed,
 		})
 	}
 
@@ -99,53 +343,184 @@ func (reporter ProgressReporter) PrintTests(aggregation *c.Aggregation) {
 		return
 	}
 
-	for _, test := range aggregation.Tests() {
-		if test.Status == "pass" {
+	for _, test := range reporter.flattenTree(aggregation) {
+		if test.Status == "pass" || !test.Reportable() {
 			continue
 		}
 
 		position += 1
-		output := "\n"
-		prefix := fmt.Sprintf("%d) ", position)
-		indent := strings.Repeat(" ", len(prefix))
-		output += c.Color.Apply(c.Color.Color(test.Status), prefix+test.ReadableName) + "\n"
+		fmt.Fprint(reporter.Output.Stdout, reporter.formatTest(test, position))
+	}
+}
 
-		if test.ErrorTrace != "" {
-			output += indent + c.Color.Detail(test.ErrorTrace) + "\n\n"
+func (reporter ProgressReporter) formatTest(test *c.Test, position int) string {
+	output := "\n"
+	prefix := fmt.Sprintf("%d) ", position)
+	indent := strings.Repeat(" ", len(prefix))
+	title := prefix + test.ReadableName
+	errorTrace := test.ErrorTrace
+	userFrames := []c.StackFrame{}
+
+	if test.Panic != nil {
+		userFrames = test.Panic.UserFrames(test.Package, test.Name)
+
+		if test.Panic.TimedOut {
+			title += " (timed out)"
+		} else if test.Panic.Hung {
+			title += " (hung)"
+		} else {
+			title += " (panicked)"
+		}
+
+		if errorTrace == "" && len(userFrames) > 0 {
+			errorTrace = userFrames[0].Location()
+		}
+	}
+
+	if test.Status == "flaky" {
+		title += fmt.Sprintf(" (flaky, passed on attempt %d)", test.Attempts)
+	}
+
+	output += c.Color.Apply(c.Color.Color(test.Status), title) + "\n"
+
+	if errorTrace != "" {
+		output += indent + c.Color.Detail(errorTrace) + "\n\n"
+	} else {
+		output += "\n"
+	}
+
+	if test.FuzzInput != "" {
+		output += indent + c.Color.Text("Failing input: ") + c.Color.Detail(test.FuzzInput) + "\n\n"
+	}
+
+	lines := reporter.formatLines(reporter.deindentOutput(test.Output))
+
+	if len(test.Got) > 0 || len(test.Want) > 0 {
+		lines = append(lines, reporter.formatLines(reporter.exampleDiff(test))...)
+	}
+
+	for _, line := range lines {
+		trimmedLine := strings.TrimSpace(line)
+
+		ignore := strings.HasPrefix(trimmedLine, "=== RUN") ||
+			strings.HasPrefix(trimmedLine, "--- FAIL:") ||
+			strings.HasPrefix(trimmedLine, "Error Trace:") ||
+			trimmedLine == test.ErrorTrace+":" ||
+			trimmedLine == test.Source+":" ||
+			strings.HasPrefix(trimmedLine, "Test:") ||
+			strings.HasPrefix(trimmedLine, "fuzz: ") ||
+			strings.HasPrefix(trimmedLine, "coverage: ") ||
+			trimmedLine == "To re-run:" ||
+			strings.Contains(line, test.Name)
+
+		if ignore {
+			continue
+		}
+
+		if trimmedLine != "" {
+			output += indent + c.Color.Text(line) + "\n"
 		} else {
 			output += "\n"
 		}
+	}
 
-		lines := reporter.formatLines(reporter.deindentOutput(test.Output))
+	if test.Source != "" {
+		output += "\n" + indent + "        " + c.Color.Fail(test.Source) + "\n"
+	}
 
-		for _, line := range lines {
-			trimmedLine := strings.TrimSpace(line)
+	if test.Panic != nil {
+		output += reporter.formatPanic(test.Panic, userFrames, indent)
+	}
 
-			ignore := strings.HasPrefix(trimmedLine, "=== RUN") ||
-				strings.HasPrefix(trimmedLine, "--- FAIL:") ||
-				strings.HasPrefix(trimmedLine, "Error Trace:") ||
-				trimmedLine == test.ErrorTrace+":" ||
-				trimmedLine == test.Source+":" ||
-				strings.HasPrefix(trimmedLine, "Test:") ||
-				strings.Contains(line, test.Name)
+	return output
+}
 
-			if ignore {
-				continue
-			}
+// formatPanic shows the panic message and the frames from user code. The
+// full goroutine dump is usually too long to be useful, so it's only
+// displayed when requested.
+func (reporter ProgressReporter) formatPanic(p *c.Panic, userFrames []c.StackFrame, indent string) string {
+	output := ""
+	message := "panic: " + p.Message
 
-			if trimmedLine != "" {
-				output += indent + c.Color.Text(line) + "\n"
-			} else {
-				output += "\n"
-			}
+	if p.Hung {
+		message = "No output for too long, goroutines dumped with " + p.Message
+	}
+
+	for _, line := range strings.Split(message, "\n") {
+		output += indent + c.Color.Fail(line) + "\n"
+	}
+
+	if len(userFrames) > 0 {
+		output += "\n"
+	}
+
+	for _, frame := range userFrames {
+		output += indent + c.Color.Text(frame.Function) + "\n"
+		output += indent + "    " + c.Color.Detail(frame.Location()) + "\n"
+	}
+
+	if reporter.FullTrace {
+		output += "\n"
+
+		for _, line := range p.Output {
+			output += indent + c.Color.Text(strings.ReplaceAll(line, "\t", "    ")) + "\n"
 		}
 
-		if test.Source != "" {
-			output += "\n" + indent + "        " + c.Color.Fail(test.Source) + "\n"
+		return output
+	}
+
+	frames := 0
+
+	for _, goroutine := range p.Goroutines {
+		frames += len(goroutine.Frames)
+	}
+
+	output += fmt.Sprintf(
+		"\n%s%s\n",
+		indent,
+		c.Color.Detail(fmt.Sprintf(
+			"Full goroutine dump hidden (%d goroutines, %d frames), use --full-trace to show it.",
+			len(p.Goroutines),
+			frames,
+		)),
+	)
+
+	return output
+}
+
+func (reporter ProgressReporter) exampleDiff(test *c.Test) []string {
+	lines := []string{"Error:  Output mismatch", "", "        Diff:", "        --- Expected", "        +++ Actual"}
+
+	for _, line := range diffLines(test.Want, test.Got) {
+		lines = append(lines, "        "+line)
+	}
+
+	return lines
+}
+
+func (reporter ProgressReporter) flattenTree(aggregation *c.Aggregation) []*c.Test {
+	tests := []*c.Test{}
+	tree := aggregation.TestTree()
+	packages := maps.Keys(tree)
+	slices.Sort(packages)
+
+	var walk func(test *c.Test)
+
+	walk = func(test *c.Test) {
+		tests = append(tests, test)
+
+		for _, child := range test.Children {
+			walk(child)
 		}
+	}
 
-		fmt.Fprint(reporter.Output.Stdout, output)
+	for _, pkg := range packages {
+		for _, test := range tree[pkg] {
+			walk(test)
+		}
 	}
+
+	return tests
 }
 
 func (reporter ProgressReporter) PrintCoverage(aggregation *c.Aggregation) {
@@ -158,20 +533,97 @@ func (reporter ProgressReporter) PrintCoverage(aggregation *c.Aggregation) {
 	fmt.Fprint(reporter.Output.Stdout, "\n"+c.Color.Text("Coverage:")+"\n\n")
 
 	for _, coverage := range coverages {
-		line := fmt.Sprintf("[%.1f%%] %s", coverage.Coverage, coverage.Package)
+		line := reporter.formatCoverage(coverage.Coverage, coverage.Package, nil)
 
-		if coverage.Coverage < 50.0 {
-			line = c.Color.Fail(line)
-		} else if coverage.Coverage < 70.0 {
-			line = c.Color.Skip(line)
-		} else {
-			line = c.Color.Pass(line)
+		if coverage.UnitCoverage != nil {
+			line += " " + c.Color.Detail(fmt.Sprintf("(unit tests: %.1f%%)", *coverage.UnitCoverage))
 		}
 
 		fmt.Fprint(reporter.Output.Stdout, line+"\n")
+
+		files := coverage.LeastCoveredFiles(aggregation.CoverageThreshold, aggregation.CoverageCount)
+
+		for _, file := range files {
+			line := reporter.formatCoverage(file.Coverage, path.Base(file.File), file.Uncovered)
+			fmt.Fprint(reporter.Output.Stdout, "  "+line+"\n")
+
+			functions := file.LeastCoveredFunctions(aggregation.CoverageThreshold, aggregation.CoverageCount)
+
+			for _, function := range functions {
+				line := reporter.formatCoverage(function.Coverage, function.Name, function.Uncovered)
+				fmt.Fprint(reporter.Output.Stdout, "    "+line+"\n")
+			}
+		}
+	}
+}
+
+func (reporter ProgressReporter) PrintDiffCoverage(aggregation *c.Aggregation) {
+	diff := aggregation.DiffCoverage
+
+	if diff == nil {
+		return
+	}
+
+	fmt.Fprint(reporter.Output.Stdout, "\n"+c.Color.Text("Coverage of changes since "+diff.Ref+":")+"\n\n")
+
+	if diff.Statements == 0 {
+		fmt.Fprintln(reporter.Output.Stdout, c.Color.Text("No changed statements."))
+		return
+	}
+
+	summary := fmt.Sprintf("%d of %d changed statements", diff.Covered, diff.Statements)
+	fmt.Fprint(reporter.Output.Stdout, reporter.formatCoverage(diff.Coverage, summary, nil)+"\n")
+
+	for _, file := range diff.Files {
+		if len(file.Uncovered) > 0 {
+			line := reporter.formatCoverage(file.Coverage, file.File, file.Uncovered)
+			fmt.Fprint(reporter.Output.Stdout, "  "+line+"\n")
+		}
+	}
+}
+
+func (reporter ProgressReporter) PrintCoverageGate(aggregation *c.Aggregation) {
+	failures := aggregation.CoverageGateFailures()
+
+	if len(failures) == 0 {
+		return
+	}
+
+	fmt.Fprint(reporter.Output.Stdout, "\n"+c.Color.Fail("Coverage gate failed:")+"\n\n")
+
+	for _, failure := range failures {
+		fmt.Fprintln(reporter.Output.Stdout, "  "+c.Color.Text(failure.String()))
 	}
 }
 
+func (reporter ProgressReporter) formatCoverage(percent float64, name string, uncovered []c.LineRange) string {
+	line := fmt.Sprintf("[%.1f%%] %s", percent, name)
+
+	if percent < 50.0 {
+		line = c.Color.Fail(line)
+	} else if percent < 70.0 {
+		line = c.Color.Skip(line)
+	} else {
+		line = c.Color.Pass(line)
+	}
+
+	if len(uncovered) == 0 {
+		return line
+	}
+
+	ranges := []string{}
+
+	for _, lineRange := range uncovered[:min(len(uncovered), 5)] {
+		ranges = append(ranges, lineRange.String())
+	}
+
+	if len(uncovered) > 5 {
+		ranges = append(ranges, fmt.Sprintf("and %d more", len(uncovered)-5))
+	}
+
+	return line + " " + c.Color.Detail("(uncovered: "+strings.Join(ranges, ", ")+")")
+}
+
 func (reporter ProgressReporter) PrintSlowestTests(aggregation *c.Aggregation) {
 	tests := aggregation.SlowestTests()
 
@@ -221,19 +673,43 @@ func (reporter ProgressReporter) OnProgress(test c.Test) {
 	}
 
 	symbols := map[string]string{
-		"fail": env("BOLT_FAIL_SYMBOL", "F"),
-		"pass": env("BOLT_PASS_SYMBOL", "."),
-		"skip": env("BOLT_SKIP_SYMBOL", "S"),
+		"fail":  env("BOLT_FAIL_SYMBOL", "F"),
+		"pass":  env("BOLT_PASS_SYMBOL", "."),
+		"skip":  env("BOLT_SKIP_SYMBOL", "S"),
+		"flaky": env("BOLT_FLAKY_SYMBOL", "~"),
 	}
 
-	fmt.Fprint(
-		reporter.Output.Stdout,
-		c.Color.Apply(c.Color.Color(test.Status), symbols[test.Status]),
-	)
+	output := c.Color.Apply(c.Color.Color(test.Status), symbols[test.Status])
+
+	if reporter.Instafail != nil {
+		output += reporter.Instafail.OnProgress(test)
+	}
+
+	reporter.print(output)
 }
 
 func (reporter ProgressReporter) OnData(line string) {
+	if reporter.StatusLine != nil {
+		reporter.StatusLine.OnData(line)
+	}
+
+	if reporter.Instafail != nil {
+		reporter.print(reporter.Instafail.OnData(line))
+	}
+}
+
+// print writes progress output, keeping the status line below it.
+func (reporter ProgressReporter) print(output string) {
+	if output == "" {
+		return
+	}
 
+	if reporter.StatusLine != nil {
+		reporter.StatusLine.Print(output)
+		return
+	}
+
+	fmt.Fprint(reporter.Output.Stdout, output)
 }
 
 func (reporter ProgressReporter) formatLines(lines []string) []string {
@@ -248,6 +724,10 @@ func (reporter ProgressReporter) formatLines(lines []string) []string {
 
 	isDiff := diff.MatchString(strings.Join(lines, "\n"))
 
+	// The lines may be the test's output, which is formatted again for the
+	// final report when using --instafail.
+	lines = slices.Clone(lines)
+
 	for index, line := range lines {
 		line = strings.TrimRight(line, " \t\r\n")
 
@@ -301,6 +781,7 @@ func (reporter ProgressReporter) deindentOutput(output []string) []string {
 	errorIndex := -1
 	errorLabel := "Error:  "
 	errorSpacing := strings.Repeat(" ", len(errorLabel))
+	output = slices.Clone(output)
 
 	for index, line := range output {
 		matches := re.FindStringSubmatch(line)
@@ -336,6 +817,53 @@ func (reporter ProgressReporter) deindentOutput(output []string) []string {
 	return lines
 }
 
+// diffLines returns a line-based diff using the longest common subsequence,
+// with removed lines prefixed by "-" and added lines prefixed by "+".
+func diffLines(expected []string, actual []string) []string {
+	lcs := make([][]int, len(expected)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(actual)+1)
+	}
+
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			if expected[i] == actual[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := []string{}
+	i, j := 0, 0
+
+	for i < len(expected) && j < len(actual) {
+		if expected[i] == actual[j] {
+			lines = append(lines, "  "+expected[i])
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			lines = append(lines, "- "+expected[i])
+			i++
+		} else {
+			lines = append(lines, "+ "+actual[j])
+			j++
+		}
+	}
+
+	for ; i < len(expected); i++ {
+		lines = append(lines, "- "+expected[i])
+	}
+
+	for ; j < len(actual); j++ {
+		lines = append(lines, "+ "+actual[j])
+	}
+
+	return lines
+}
+
 func formatDuration(duration time.Duration, places int) string {
 	result := duration.String()
 	re := regexp.MustCompile(`(?:(\d+(?:\.\d+)?)([^\d]+))`)
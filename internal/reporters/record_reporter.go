@@ -0,0 +1,28 @@
+package reporters
+
+import (
+	"fmt"
+	"io"
+
+	c "github.com/fnando/bolt/common"
+)
+
+// RecordReporter writes every line it receives, including the ones that
+// aren't JSON events, so the file can be used with --replay.
+type RecordReporter struct {
+	Writer io.Writer
+}
+
+func (reporter RecordReporter) Name() string {
+	return "record"
+}
+
+func (reporter RecordReporter) OnFinished(options ReporterFinishedOptions) {
+}
+
+func (reporter RecordReporter) OnProgress(test c.Test) {
+}
+
+func (reporter RecordReporter) OnData(line string) {
+	fmt.Fprintln(reporter.Writer, line)
+}
@@ -12,6 +12,7 @@ type Reporter interface {
 type ReporterFinishedOptions struct {
 	Aggregation  *c.Aggregation
 	HideCoverage bool
+	HidePackages bool
 	HideSlowest  bool
 	Debug        bool
 }
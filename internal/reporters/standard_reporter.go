@@ -9,7 +9,8 @@ import (
 )
 
 type StandardReporter struct {
-	Output *c.Output
+	Output    *c.Output
+	Instafail *Instafail
 }
 
 func (reporter StandardReporter) Name() string {
@@ -17,19 +18,27 @@ func (reporter StandardReporter) Name() string {
 }
 
 func (reporter StandardReporter) OnFinished(options ReporterFinishedOptions) {
-
+	if reporter.Instafail != nil {
+		fmt.Fprint(reporter.Output.Stdout, reporter.Instafail.Flush())
+	}
 }
 
 func (reporter StandardReporter) OnProgress(test c.Test) {
-
+	if reporter.Instafail != nil {
+		fmt.Fprint(reporter.Output.Stdout, reporter.Instafail.OnProgress(test))
+	}
 }
 
 func (reporter StandardReporter) OnData(line string) {
 	var data c.Stream
 	err := json.Unmarshal([]byte(line), &data)
 
+	if reporter.Instafail != nil {
+		fmt.Fprint(reporter.Output.Stdout, reporter.Instafail.OnData(line))
+	}
+
 	if err != nil {
-		fmt.Fprint(reporter.Output.Stdout, line)
+		fmt.Fprintln(reporter.Output.Stdout, line)
 	} else {
 		fmt.Fprint(reporter.Output.Stdout, reporter.formatLine(data.Output))
 	}
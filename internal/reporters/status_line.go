@@ -0,0 +1,303 @@
+package reporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	c "github.com/fnando/bolt/common"
+	"golang.org/x/exp/slices"
+)
+
+// StatusLine is redrawn below the progress dots, showing the tests that are
+// running, how many packages are done and an estimate of the remaining time
+// based on previous runs. It must only be used when stdout is a terminal.
+type StatusLine struct {
+	output       io.Writer
+	mutex        sync.Mutex
+	width        int
+	column       int
+	packages     int
+	timings      c.Timings
+	expected     time.Duration
+	done         time.Duration
+	startedAt    time.Time
+	running      map[string]time.Time
+	donePackages map[string]bool
+	visible      bool
+	stop         chan struct{}
+}
+
+const maxStatusLineTests = 3
+
+var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// NewStatusLine starts redrawing the status line every second, until Stop is
+// called. The expected duration of the run is the sum of the timings of each
+// package's tests.
+func NewStatusLine(output *c.Output, packages []string, timings c.Timings) *StatusLine {
+	status := &StatusLine{
+		output:       output.Stdout,
+		width:        terminalWidth(),
+		packages:     len(packages),
+		timings:      timings,
+		startedAt:    time.Now(),
+		running:      map[string]time.Time{},
+		donePackages: map[string]bool{},
+		stop:         make(chan struct{}),
+	}
+
+	for _, pkg := range packages {
+		if packageTimings, exists := timings.Packages[pkg]; exists {
+			for _, elapsed := range packageTimings.Tests {
+				status.expected += elapsed
+			}
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				status.mutex.Lock()
+				status.draw()
+				status.mutex.Unlock()
+			case <-status.stop:
+				return
+			}
+		}
+	}()
+
+	return status
+}
+
+// IsTerminal tells whether the writer is a terminal, where the status line
+// can be redrawn.
+func IsTerminal(writer io.Writer) bool {
+	file, ok := writer.(*os.File)
+
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	stat, err := file.Stat()
+
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// OnData keeps track of running tests and finished packages.
+func (status *StatusLine) OnData(line string) {
+	var stream c.Stream
+
+	if json.Unmarshal([]byte(line), &stream) != nil || stream.Package == "" {
+		return
+	}
+
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	key := stream.Package + ":" + stream.Test
+
+	switch stream.Action {
+	case "run":
+		status.running[key] = time.Now()
+
+	case "pass", "fail", "skip":
+		if stream.Test == "" {
+			status.donePackages[stream.Package] = true
+			return
+		}
+
+		delete(status.running, key)
+
+		if !strings.Contains(stream.Test, "/") {
+			elapsed, _ := status.timings.Test(stream.Package, stream.Test)
+			status.done += elapsed
+		}
+	}
+}
+
+// Print writes text (e.g. a dot) where the progress output is, keeping the
+// status line below it.
+func (status *StatusLine) Print(text string) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	status.clear()
+	fmt.Fprint(status.output, text)
+
+	for _, char := range ansiRegex.ReplaceAllString(text, "") {
+		if char == '\n' {
+			status.column = 0
+			continue
+		}
+
+		if status.column == status.width {
+			status.column = 0
+		}
+
+		status.column += 1
+	}
+
+	// The cursor stays at the end of a full line until something else is
+	// written, so the line break is added right away.
+	if status.column == status.width {
+		fmt.Fprintln(status.output)
+		status.column = 0
+	}
+
+	status.draw()
+}
+
+// Stop removes the status line, so the final report can be printed.
+func (status *StatusLine) Stop() {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	select {
+	case <-status.stop:
+		return
+	default:
+		close(status.stop)
+	}
+
+	status.clear()
+}
+
+func (status *StatusLine) clear() {
+	if status.visible {
+		fmt.Fprint(status.output, "\033[J")
+		status.visible = false
+	}
+}
+
+// draw writes the status on the line below the cursor, then moves back to
+// where the progress output ends.
+func (status *StatusLine) draw() {
+	select {
+	case <-status.stop:
+		return
+	default:
+	}
+
+	text := status.text()
+
+	if utf8.RuneCountInString(text) >= status.width {
+		text = string([]rune(text)[:status.width-1])
+	}
+
+	fmt.Fprint(status.output, "\n\r\033[K"+c.Color.Detail(text)+"\033[1A\r")
+
+	if status.column > 0 {
+		fmt.Fprintf(status.output, "\033[%dC", status.column)
+	}
+
+	status.visible = true
+}
+
+func (status *StatusLine) text() string {
+	now := time.Now()
+	parts := []string{}
+	names := []string{}
+
+	for key := range status.running {
+		if !status.hasRunningSubtests(key) {
+			names = append(names, key)
+		}
+	}
+
+	// Tests running for longer are more interesting.
+	slices.SortFunc(names, func(a, b string) int {
+		return status.running[a].Compare(status.running[b])
+	})
+
+	tests := []string{}
+
+	for index, key := range names {
+		if index == maxStatusLineTests {
+			tests = append(tests, fmt.Sprintf("+%d more", len(names)-index))
+			break
+		}
+
+		_, name, _ := strings.Cut(key, ":")
+		elapsed := now.Sub(status.running[key]).Round(time.Second)
+		tests = append(tests, fmt.Sprintf("%s (%s)", name, elapsed))
+	}
+
+	if len(tests) > 0 {
+		parts = append(parts, "Running: "+strings.Join(tests, ", "))
+	}
+
+	parts = append(parts, fmt.Sprintf("Packages: %d/%d", len(status.donePackages), status.packages))
+
+	if eta, ok := status.eta(now); ok {
+		parts = append(parts, "ETA: "+eta.Round(time.Second).String())
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+func (status *StatusLine) hasRunningSubtests(key string) bool {
+	for other := range status.running {
+		if strings.HasPrefix(other, key+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// eta extrapolates the remaining time from how fast the expected duration of
+// tests has been going, which accounts for packages running in parallel.
+// Running tests count up to their expected duration.
+func (status *StatusLine) eta(now time.Time) (time.Duration, bool) {
+	elapsed := now.Sub(status.startedAt)
+	done := status.done
+
+	for key, startedAt := range status.running {
+		pkg, name, _ := strings.Cut(key, ":")
+
+		if expected, exists := status.timings.Test(pkg, name); exists && !strings.Contains(name, "/") {
+			done += min(now.Sub(startedAt), expected)
+		}
+	}
+
+	if done <= 0 || status.expected <= done || elapsed <= 0 {
+		return 0, false
+	}
+
+	rate := float64(done) / float64(elapsed)
+
+	return time.Duration(float64(status.expected-done) / rate), true
+}
+
+// terminalWidth uses $COLUMNS, then stty, defaulting to 80 columns.
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	fields := strings.Fields(string(out))
+
+	if err == nil && len(fields) == 2 {
+		if columns, err := strconv.Atoi(fields[1]); err == nil && columns > 0 {
+			return columns
+		}
+	}
+
+	return 80
+}
@@ -2,6 +2,8 @@ package bench
 
 import "testing"
 
+var sink []int
+
 func BenchmarkFib1(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		fib(1)
@@ -61,3 +63,20 @@ func BenchmarkFib10(b *testing.B) {
 		fib(10)
 	}
 }
+
+func BenchmarkFibSlice(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(8)
+
+	for n := 0; n < b.N; n++ {
+		values := make([]int, 10)
+
+		for i := range values {
+			values[i] = fib(i)
+		}
+
+		sink = values
+	}
+
+	b.ReportMetric(10, "calls/op")
+}
@@ -0,0 +1,37 @@
+//go:build reference
+// +build reference
+
+package shapes
+
+import "errors"
+
+type Square struct {
+	Side float64
+}
+
+func (s *Square) Area() float64 {
+	return s.Side * s.Side
+}
+
+func (s *Square) Validate() error {
+	if s.Side < 0 {
+		return errors.New("side can't be negative")
+	}
+
+	if s.Side == 0 {
+		return errors.New("side can't be zero")
+	}
+
+	return nil
+}
+
+func Describe(area float64) string {
+	switch {
+	case area > 100:
+		return "large"
+	case area > 10:
+		return "medium"
+	default:
+		return "small"
+	}
+}
@@ -0,0 +1,18 @@
+//go:build reference
+// +build reference
+
+package shapes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArea(t *testing.T) {
+	assert.Equal(t, 4.0, (&Square{Side: 2}).Area())
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, (&Square{Side: 2}).Validate())
+}
@@ -0,0 +1,14 @@
+//go:build reference
+// +build reference
+
+package examples
+
+import "strings"
+
+func Greet(name string) string {
+	return "Hello, " + name + "!"
+}
+
+func Shout(text string) string {
+	return strings.ToUpper(text)
+}
@@ -0,0 +1,19 @@
+//go:build reference
+// +build reference
+
+package examples
+
+import "fmt"
+
+func ExampleGreet() {
+	fmt.Println(Greet("John"))
+	// Output: Hello, John!
+}
+
+func ExampleShout() {
+	fmt.Println(Shout("hello"))
+	fmt.Println(Shout("bye"))
+	// Output:
+	// HELLO
+	// bye
+}
@@ -0,0 +1,18 @@
+//go:build reference
+// +build reference
+
+package fuzz
+
+func Reverse(text string) string {
+	runes := []rune(text)
+
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+
+	if len(runes) > 3 {
+		return string(runes[1:])
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,24 @@
+//go:build reference
+// +build reference
+
+package fuzz
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzReverse(f *testing.F) {
+	f.Add("abc")
+	f.Add("ab")
+
+	f.Fuzz(func(t *testing.T, text string) {
+		if !utf8.ValidString(text) {
+			t.Skip()
+		}
+
+		if Reverse(Reverse(text)) != text {
+			t.Errorf("before: %q, after: %q", text, Reverse(Reverse(text)))
+		}
+	})
+}
@@ -0,0 +1,24 @@
+//go:build reference
+// +build reference
+
+package panic
+
+import "testing"
+
+type user struct {
+	name string
+}
+
+func greet(u *user) string {
+	return "Hello, " + u.name
+}
+
+func TestPass(t *testing.T) {
+}
+
+func TestNilUser(t *testing.T) {
+	greet(nil)
+}
+
+func TestAfterPanic(t *testing.T) {
+}
@@ -0,0 +1,23 @@
+//go:build reference
+// +build reference
+
+package parallel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParallelFirst(t *testing.T) {
+	t.Parallel()
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestParallelSecond(t *testing.T) {
+	t.Parallel()
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestSequential(t *testing.T) {
+	time.Sleep(50 * time.Millisecond)
+}
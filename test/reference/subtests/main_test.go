@@ -0,0 +1,37 @@
+//go:build reference
+// +build reference
+
+package subtests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUser(t *testing.T) {
+	t.Run("signs in", func(t *testing.T) {
+		assert.Equal(t, "signed in", "signed in")
+	})
+
+	t.Run("signs out", func(t *testing.T) {
+		assert.Equal(t, "signed out", "signed in")
+	})
+}
+
+func TestSum(t *testing.T) {
+	cases := []struct {
+		name     string
+		a, b     int
+		expected int
+	}{
+		{"positive numbers", 1, 2, 3},
+		{"negative numbers", -1, -2, -4},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.a+tc.b)
+		})
+	}
+}
@@ -0,0 +1,24 @@
+//go:build reference
+// +build reference
+
+package testmain
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	exitcode := m.Run()
+
+	if exitcode == 0 {
+		fmt.Println("database was not cleaned up")
+		exitcode = 1
+	}
+
+	os.Exit(exitcode)
+}
+
+func TestPass(t *testing.T) {
+}
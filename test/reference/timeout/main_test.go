@@ -0,0 +1,24 @@
+//go:build reference
+// +build reference
+
+package timeout
+
+import (
+	"testing"
+	"time"
+)
+
+func wait(done chan bool) {
+	<-done
+}
+
+func TestPass(t *testing.T) {
+}
+
+func TestWaitForever(t *testing.T) {
+	wait(make(chan bool))
+}
+
+func TestSleep(t *testing.T) {
+	time.Sleep(time.Second)
+}